@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ArtStyle is how the pictures in a story are drawn. Prompt goes on the end
+// of every image prompt, Negative is what that style should stay away from,
+// and StylePreset is the closest of Stability's style_presets (if any).
+type ArtStyle struct {
+	Name        string
+	Prompt      string
+	Negative    string
+	StylePreset string
+}
+
+var artStyles = map[string]ArtStyle{
+	"watercolor": {
+		Name:     "watercolor",
+		Prompt:   "a soft watercolor painting done in the style of a childrens book",
+		Negative: "photograph, 3d render, harsh outlines",
+	},
+	"crayon": {
+		Name:     "crayon",
+		Prompt:   "a bright crayon drawing on textured paper done in the style of a childrens book",
+		Negative: "photograph, 3d render, smooth gradients",
+	},
+	"paper-cutout": {
+		Name:        "paper-cutout",
+		Prompt:      "a layered paper cutout collage done in the style of a childrens book",
+		Negative:    "photograph, painting, brush strokes",
+		StylePreset: "origami",
+	},
+	"pixel-art": {
+		Name:        "pixel-art",
+		Prompt:      "colorful pixel art done in the style of a childrens book",
+		Negative:    "photograph, blurry, smooth shading",
+		StylePreset: "pixel-art",
+	},
+	"pencil-sketch": {
+		Name:        "pencil-sketch",
+		Prompt:      "a pencil sketch with gentle shading done in the style of a childrens book",
+		Negative:    "photograph, 3d render, bright colors",
+		StylePreset: "line-art",
+	},
+	"clay": {
+		Name:        "clay",
+		Prompt:      "a scene made of modeling clay done in the style of a childrens book",
+		Negative:    "photograph, flat drawing",
+		StylePreset: "modeling-compound",
+	},
+	"comic": {
+		Name:        "comic",
+		Prompt:      "a bold comic book panel done in the style of a childrens book",
+		Negative:    "photograph, 3d render, speech bubbles",
+		StylePreset: "comic-book",
+	},
+}
+
+const defaultArtStyle = "watercolor"
+
+func getArtStyleNames() []string {
+	names := make([]string, 0, len(artStyles))
+	for name := range artStyles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func isArtStyle(name string) bool {
+	_, ok := artStyles[strings.ToLower(strings.TrimSpace(name))]
+
+	return name == "" || ok
+}
+
+// Stories from before there was a list of styles could say anything, so a
+// name that isn't on the list still gets drawn the way it used to be.
+func getArtStyle(name string) ArtStyle {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = defaultArtStyle
+	}
+	if style, ok := artStyles[name]; ok {
+		return style
+	}
+
+	return ArtStyle{
+		Name:   name,
+		Prompt: fmt.Sprintf("a %s done in the style of a childrens book", name),
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+type BatchResult struct {
+	Id          string
+	Synopsis    StorySynopsis
+	Title       string
+	Outputs     map[string]string
+	FailedStage string `json:",omitempty"`
+	Error       string `json:",omitempty"`
+	Log         string
+}
+
+// Each story in a batch gets its own storybook process so one bad story
+// can't take the rest of the classroom down with it.
+func batchCommand(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("batch", flag.ExitOnError)
+	concurrency := flags.Int("concurrency", 2, "how many stories to write at once")
+	reportPath := flags.String("report", "", "where to write the summary report (default ./batch-<timestamp>.json)")
+	publisherNames := flags.String("publishers", PUBLISHERS, "comma separated publishers to run for every story")
+	textProvider, imageProvider := addProviderFlags(flags)
+	positional := parseFlags(flags, args)
+	applyProviderFlags(textProvider, imageProvider)
+	requireValidConfig(true, getPublisherNames(*publisherNames))
+	if len(positional) < 1 {
+		fmt.Println("Which stories? Try \"storybook batch <synopses.csv|synopses.jsonl>\".")
+		os.Exit(2)
+	}
+	if *concurrency < 1 {
+		*concurrency = 1
+	}
+	if *reportPath == "" {
+		*reportPath = fmt.Sprintf("./batch-%s.json", time.Now().Format("20060102-150405"))
+	}
+
+	synopses, err := readSynopses(positional[0])
+	if err != nil {
+		if DEBUG {
+			panic(err)
+		}
+		fmt.Println("I couldn't make heads or tails of that file.")
+		os.Exit(1)
+	}
+	for _, synopsis := range synopses {
+		if _, ok := getAudience(synopsis.Audience); !ok {
+			fmt.Printf("I don't know how to write for %q. Try %s.\n", synopsis.Audience, strings.Join(getAudienceNames(), ", "))
+			os.Exit(2)
+		}
+		if !isArtStyle(synopsis.Style) {
+			fmt.Printf("I don't know how to draw in %q. Try %s.\n", synopsis.Style, strings.Join(getArtStyleNames(), ", "))
+			os.Exit(2)
+		}
+		if synopsis.Length < 0 {
+			fmt.Printf("The story about %s the %s can't be %d paragraphs long.\n", synopsis.Name, synopsis.Animal, synopsis.Length)
+			os.Exit(2)
+		}
+		if synopsis.FromCover < 0 || synopsis.FromCover >= 1 {
+			fmt.Printf("The story about %s the %s can't keep %g of the cover, from_cover has to be at least 0 and less than 1.\n", synopsis.Name, synopsis.Animal, synopsis.FromCover)
+			os.Exit(2)
+		}
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Alright, %d stories coming up, %d at a time.\n", len(synopses), *concurrency)
+	results := make([]BatchResult, len(synopses))
+	semaphore := make(chan struct{}, *concurrency)
+	var wg sync.WaitGroup
+	for i, synopsis := range synopses {
+		wg.Add(1)
+		go func(index int, synopsis StorySynopsis) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			// Ctrl-C reaches the stories already running on its own, we just
+			// shouldn't start any new ones
+			if ctx.Err() != nil {
+				results[index] = BatchResult{Synopsis: synopsis, FailedStage: "synopsis", Error: "cancelled before it started"}
+				return
+			}
+			result := runBatchStory(executable, synopsis, *publisherNames)
+			results[index] = result
+			if result.FailedStage == "" {
+				fmt.Printf("Finished %q (%s)\n", result.Title, result.Id)
+			} else {
+				fmt.Printf("%s the %s got stuck at %s (%s)\n", synopsis.Name, synopsis.Animal, result.FailedStage, result.Id)
+			}
+		}(i, synopsis)
+	}
+	wg.Wait()
+
+	reportBytes, _ := json.MarshalIndent(results, "", "  ")
+	err = os.WriteFile(*reportPath, reportBytes, 0644)
+	if err != nil {
+		fmt.Println("I couldn't write the report down, so here it is:")
+		fmt.Println(string(reportBytes))
+	}
+
+	failures := 0
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\nID\tTITLE\tOUTPUTS\tFAILED AT")
+	for _, result := range results {
+		outputs := make([]string, 0, len(result.Outputs))
+		for _, location := range result.Outputs {
+			outputs = append(outputs, location)
+		}
+		sort.Strings(outputs)
+		if result.FailedStage != "" {
+			failures++
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", result.Id, result.Title, strings.Join(outputs, " "), result.FailedStage)
+	}
+	writer.Flush()
+	fmt.Printf("\n%d of %d stories made it. The full report is in %s\n", len(results)-failures, len(results), *reportPath)
+	if failures > 0 {
+		os.Exit(1)
+	}
+}
+
+func runBatchStory(executable string, synopsis StorySynopsis, publisherNames string) BatchResult {
+	id := uuid.New().String()
+	result := BatchResult{
+		Id:       id,
+		Synopsis: synopsis,
+		Outputs:  make(map[string]string),
+		Log:      fmt.Sprintf("./images/%s/batch.log", id),
+	}
+	os.MkdirAll(fmt.Sprintf("./images/%s", id), os.ModePerm)
+	logFile, err := os.Create(result.Log)
+	if err != nil {
+		result.FailedStage = "synopsis"
+		result.Error = err.Error()
+		return result
+	}
+	defer logFile.Close()
+
+	args := make([]string, 0)
+	if CONFIG_PATH != "" {
+		args = append(args, "--config", CONFIG_PATH)
+	}
+	args = append(
+		args,
+		"generate",
+		"--id", id,
+		"--animal", synopsis.Animal,
+		"--name", synopsis.Name,
+		"--goal", synopsis.Goal,
+		"--style", synopsis.Style,
+		"--length", strconv.Itoa(synopsis.Length),
+		"--audience", synopsis.Audience,
+		"--seed", strconv.Itoa(synopsis.Seed),
+		"--from-cover", strconv.FormatFloat(synopsis.FromCover, 'f', -1, 64),
+		"--negative", strings.Join(synopsis.Negative, ", "),
+		"--publishers", publisherNames,
+		"--text-provider", TEXT_PROVIDER,
+		"--image-provider", IMAGE_PROVIDER,
+	)
+	cmd := exec.Command(executable, args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	runErr := cmd.Run()
+
+	story, err := loadManifest(id)
+	if err != nil {
+		result.FailedStage = "synopsis"
+		result.Error = getLastLogLine(result.Log)
+		return result
+	}
+	result.Title = story.Title
+	result.Outputs = story.Outputs
+	result.FailedStage = getIncompleteStage(story, getPublisherNames(publisherNames))
+	if runErr != nil || result.FailedStage != "" {
+		result.Error = story.Failure
+		if result.Error == "" {
+			result.Error = getLastLogLine(result.Log)
+		}
+		if result.FailedStage == "" {
+			result.FailedStage = "unknown"
+		}
+	}
+
+	return result
+}
+
+// Whatever the story said on its way out is usually the most useful thing
+// to put in the report.
+func getLastLogLine(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	last := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			last = line
+		}
+	}
+
+	return last
+}
+
+func readSynopses(path string) ([]StorySynopsis, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return readSynopsesCSV(f)
+	case ".jsonl", ".ndjson":
+		return readSynopsesJSONL(f)
+	}
+
+	return nil, fmt.Errorf("%s should be a .csv or .jsonl file", path)
+}
+
+// The first row is a header naming the columns: animal, name, goal and
+// optionally style, length, audience, seed, from_cover and negative, in any
+// order.
+func readSynopsesCSV(r io.Reader) ([]StorySynopsis, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("the file is empty")
+	}
+	columns := make(map[string]int)
+	for index, column := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(column))] = index
+	}
+	get := func(row []string, column string) string {
+		index, ok := columns[column]
+		if !ok || index >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[index])
+	}
+
+	synopses := make([]StorySynopsis, 0, len(rows)-1)
+	for line, row := range rows[1:] {
+		synopsis := StorySynopsis{
+			Animal:   get(row, "animal"),
+			Name:     get(row, "name"),
+			Goal:     get(row, "goal"),
+			Style:    get(row, "style"),
+			Audience: get(row, "audience"),
+			Negative: splitPromptList(get(row, "negative")),
+		}
+		if seed := get(row, "seed"); seed != "" {
+			synopsis.Seed, err = strconv.Atoi(seed)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: seed %q isn't a number", line+2, seed)
+			}
+		}
+		if fromCover := get(row, "from_cover"); fromCover != "" {
+			synopsis.FromCover, err = strconv.ParseFloat(fromCover, 64)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: from_cover %q isn't a number", line+2, fromCover)
+			}
+		}
+		if length := get(row, "length"); length != "" {
+			synopsis.Length, err = strconv.Atoi(length)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: length %q isn't a number", line+2, length)
+			}
+		}
+		synopses = append(synopses, synopsis)
+	}
+
+	return synopses, nil
+}
+
+func readSynopsesJSONL(r io.Reader) ([]StorySynopsis, error) {
+	synopses := make([]StorySynopsis, 0)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		// The CSV column names work too, and from_cover is the only one
+		// that isn't already the field name give or take the case
+		row := struct {
+			StorySynopsis
+			FromCoverColumn *float64 `json:"from_cover"`
+		}{}
+		err := json.Unmarshal([]byte(text), &row)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if row.FromCoverColumn != nil {
+			row.FromCover = *row.FromCoverColumn
+		}
+		synopses = append(synopses, row.StorySynopsis)
+	}
+
+	return synopses, scanner.Err()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sashabaranov/go-openai/jsonschema"
+	"strings"
+)
+
+// CharacterSheet is how the main character looks, settled on once per story
+// so every illustration draws the same animal. Description is the version
+// that goes into the image prompts.
+type CharacterSheet struct {
+	Species     string
+	Colors      string
+	Clothing    string
+	Markings    string
+	Description string
+}
+
+var characterSheetSchema = jsonschema.Definition{
+	Type: jsonschema.Object,
+	Properties: map[string]jsonschema.Definition{
+		"species": {
+			Type:        jsonschema.String,
+			Description: "What kind of animal the character is, as specifically as possible",
+		},
+		"colors": {
+			Type:        jsonschema.String,
+			Description: "The colors of the character's fur, feathers, scales or skin",
+		},
+		"clothing": {
+			Type:        jsonschema.String,
+			Description: "What the character always wears, or none",
+		},
+		"markings": {
+			Type:        jsonschema.String,
+			Description: "Anything that sets the character apart, like spots, scars or a missing tooth",
+		},
+		"description": {
+			Type:        jsonschema.String,
+			Description: "All of the above in a single sentence an illustrator could work from",
+		},
+	},
+	Required: []string{"species", "colors", "clothing", "markings", "description"},
+}
+
+func (sheet CharacterSheet) isEmpty() bool {
+	return strings.TrimSpace(sheet.Description) == ""
+}
+
+func getCharacterSheet(ctx context.Context, story *Story) (CharacterSheet, error) {
+	sheet := CharacterSheet{}
+	data := getPromptData(story.Synopsis)
+	data.Story = strings.Join(story.Paragraphs, "\n\n")
+	prompt, err := renderPrompt("character", data)
+	if err != nil {
+		return sheet, err
+	}
+
+	if structured, ok := textGenerator.(StructuredTextGenerator); ok {
+		var resp string
+		err = apiRetryPolicy.Do(ctx, func(ctx context.Context) error {
+			var err error
+			resp, err = structured.GenerateStructured(ctx, prompt, "describe_character", characterSheetSchema)
+			return err
+		})
+		if err == nil {
+			err = json.Unmarshal([]byte(resp), &sheet)
+			if err != nil {
+				return sheet, fmt.Errorf("%w: %s", ErrStoryFormat, err)
+			}
+			return cleanCharacterSheet(sheet)
+		}
+		if !errors.Is(err, ErrStructuredUnsupported) {
+			return sheet, err
+		}
+	}
+
+	// A plain answer is just the description
+	resp, err := getGPTResponse(ctx, prompt)
+	if err != nil {
+		return sheet, err
+	}
+
+	return cleanCharacterSheet(CharacterSheet{Species: story.Synopsis.Animal, Description: resp})
+}
+
+func cleanCharacterSheet(sheet CharacterSheet) (CharacterSheet, error) {
+	sheet.Species = strings.TrimSpace(sheet.Species)
+	sheet.Colors = strings.TrimSpace(sheet.Colors)
+	sheet.Clothing = strings.TrimSpace(sheet.Clothing)
+	sheet.Markings = strings.TrimSpace(sheet.Markings)
+	sheet.Description = strings.TrimRight(strings.Join(strings.Fields(sheet.Description), " "), ".")
+	if sheet.isEmpty() {
+		return sheet, fmt.Errorf("%w: the character came back without a description", ErrStoryFormat)
+	}
+
+	return sheet, nil
+}
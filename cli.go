@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+var usage = `Usage: storybook [--config storybook.yaml] <command> [flags]
+
+Commands:
+  generate   write a new story (the default when no command is given)
+  resume     pick an interrupted story back up: storybook resume <story-id>
+  publish    run the configured publishers on a story: storybook publish <story-id>
+  export     write a story to an offline format: storybook export <story-id> --format pdf
+  list       show the stories written so far
+  select     show a page's candidate pictures or pick one: storybook select <story-id> <page> [candidate]
+  batch      write a whole stack of stories from a file: storybook batch <synopses.csv|.jsonl>
+  serve      take story requests over HTTP: storybook serve --addr :8080
+
+Run "storybook <command> -h" to see the flags for a command.
+`
+
+// Where the config came from, if it was picked on the command line, so batch
+// can hand it on to the stories it starts.
+var CONFIG_PATH string
+
+func runCommand(ctx context.Context, args []string) {
+	CONFIG_PATH, args = getConfigArgument(args)
+	config, err := loadConfig(CONFIG_PATH)
+	if err != nil {
+		fmt.Printf("I couldn't read the config: %s\n", err)
+		os.Exit(2)
+	}
+	applyConfig(config)
+
+	command := "generate"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
+	}
+
+	switch command {
+	case "generate":
+		generateCommand(ctx, args)
+	case "resume":
+		resumeCommand(ctx, args)
+	case "publish":
+		publishCommand(ctx, args)
+	case "export":
+		exportCommand(ctx, args)
+	case "list":
+		listCommand(args)
+	case "select":
+		selectCommand(args)
+	case "batch":
+		batchCommand(ctx, args)
+	case "serve":
+		serveCommand(ctx, args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Printf("I don't know how to %q.\n\n", command)
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+}
+
+// --config has to come before the command since it applies to all of them.
+func getConfigArgument(args []string) (string, []string) {
+	if len(args) > 1 && (args[0] == "--config" || args[0] == "-config") {
+		return args[1], args[2:]
+	}
+	if len(args) > 0 && (strings.HasPrefix(args[0], "--config=") || strings.HasPrefix(args[0], "-config=")) {
+		return args[0][strings.Index(args[0], "=")+1:], args[1:]
+	}
+
+	return "", args
+}
+
+func printBanner() {
+	banner, _ := os.ReadFile("./banner.txt")
+	tell(string(banner))
+}
+
+func generateCommand(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	animal := flags.String("animal", "", "the kind of animal the story is about")
+	name := flags.String("name", "", "the animal's name")
+	goal := flags.String("goal", "", "what the animal is trying to do")
+	style := flags.String("style", defaultArtStyle, fmt.Sprintf("how the pictures are drawn: %s", strings.Join(getArtStyleNames(), ", ")))
+	length := flags.Int("length", 0, "roughly how many paragraphs the story should be (default depends on the audience)")
+	audienceName := flags.String("audience", defaultAudience, fmt.Sprintf("who the story is for: %s", strings.Join(getAudienceNames(), ", ")))
+	seed := flags.Int("seed", 0, "draw every picture from this seed (default a new one for each)")
+	fromCover := flags.Float64("from-cover", 0, "start every page from the cover, keeping this much of it (0 to 1)")
+	negative := flags.String("negative", "", "comma separated things to keep out of this story's pictures")
+	id := flags.String("id", "", "use this id for the story instead of making one up")
+	publisherNames := flags.String("publishers", PUBLISHERS, "comma separated publishers to run when the story is done")
+	textProvider, imageProvider := addProviderFlags(flags)
+	progressMode, quips := addProgressFlags(flags)
+	parseFlags(flags, args)
+
+	audience, ok := getAudience(*audienceName)
+	if !ok {
+		fmt.Printf("I don't know how to write for %q. Try %s.\n", *audienceName, strings.Join(getAudienceNames(), ", "))
+		os.Exit(2)
+	}
+	if !isArtStyle(*style) {
+		fmt.Printf("I don't know how to draw in %q. Try %s.\n", *style, strings.Join(getArtStyleNames(), ", "))
+		os.Exit(2)
+	}
+	if *fromCover < 0 || *fromCover >= 1 {
+		fmt.Println("--from-cover has to be at least 0 and less than 1.")
+		os.Exit(2)
+	}
+	if *length < 0 {
+		fmt.Println("--length can't be negative, leave it at 0 to let the audience decide.")
+		os.Exit(2)
+	}
+	applyProviderFlags(textProvider, imageProvider)
+	requireValidConfig(true, getPublisherNames(*publisherNames))
+	setupProgress(*progressMode, *quips)
+	printBanner()
+	setupProviders()
+	publishers = getPublishers(*publisherNames)
+	story := buildStory()
+	if *id != "" {
+		storyId, err := uuid.Parse(*id)
+		if err != nil {
+			fmt.Println("That doesn't look like a story id to me.")
+			os.Exit(2)
+		}
+		story.Id = storyId
+	}
+	story.Synopsis = StorySynopsis{
+		Animal:    strings.TrimSpace(*animal),
+		Name:      strings.TrimSpace(*name),
+		Goal:      strings.TrimSpace(*goal),
+		Style:     strings.ToLower(strings.TrimSpace(*style)),
+		Length:    *length,
+		Audience:  audience.Name,
+		Seed:      *seed,
+		FromCover: *fromCover,
+		Negative:  splitPromptList(*negative),
+	}
+	collectSynopsisFromUser(story)
+	if story.Synopsis.Animal == "" || story.Synopsis.Name == "" || story.Synopsis.Goal == "" {
+		fmt.Println("I need an animal, a name, and a goal to write a story.")
+		os.Exit(2)
+	}
+	saveManifest(story)
+	err := runPipeline(ctx, story)
+	if err != nil {
+		reportFailure(story, err)
+		os.Exit(1)
+	}
+}
+
+func resumeCommand(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("resume", flag.ExitOnError)
+	publisherNames := flags.String("publishers", PUBLISHERS, "comma separated publishers to run when the story is done")
+	textProvider, imageProvider := addProviderFlags(flags)
+	progressMode, quips := addProgressFlags(flags)
+	positional := parseFlags(flags, args)
+
+	applyProviderFlags(textProvider, imageProvider)
+	requireValidConfig(true, getPublisherNames(*publisherNames))
+	setupProgress(*progressMode, *quips)
+	story := loadStoryArgument(flags.Name(), positional)
+	printBanner()
+	setupProviders()
+	publishers = getPublishers(*publisherNames)
+	say(fmt.Sprintf("Oh right! The one about %s the %s. Let's pick up where we left off.", story.Synopsis.Name, story.Synopsis.Animal))
+	err := runPipeline(ctx, story)
+	if err != nil {
+		reportFailure(story, err)
+		os.Exit(1)
+	}
+}
+
+func publishCommand(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("publish", flag.ExitOnError)
+	publisherNames := flags.String("publishers", PUBLISHERS, "comma separated publishers to run")
+	progressMode, quips := addProgressFlags(flags)
+	positional := parseFlags(flags, args)
+
+	requireValidConfig(false, getPublisherNames(*publisherNames))
+	setupProgress(*progressMode, *quips)
+	story := loadStoryArgument(flags.Name(), positional)
+	requireFinishedStory(story)
+	publishers = getPublishers(*publisherNames)
+	for _, publisher := range publishers {
+		delete(story.Outputs, publisher.Name())
+	}
+	err := publishStory(ctx, story)
+	printOutputs(story)
+	if err != nil {
+		reportFailure(story, err)
+		os.Exit(1)
+	}
+}
+
+func exportCommand(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "pdf", "one of pdf, epub, site, or dryrun")
+	progressMode, quips := addProgressFlags(flags)
+	positional := parseFlags(flags, args)
+
+	setupProgress(*progressMode, *quips)
+	story := loadStoryArgument(flags.Name(), positional)
+	requireFinishedStory(story)
+	switch *format {
+	case "pdf", "epub", "site", "dryrun":
+	default:
+		fmt.Printf("I can only export to pdf, epub, site, or dryrun. Try \"storybook publish\" for %q.\n", *format)
+		os.Exit(2)
+	}
+	requireValidConfig(false, []string{*format})
+	publishers = getPublishers(*format)
+	delete(story.Outputs, *format)
+	err := publishStory(ctx, story)
+	printOutputs(story)
+	if err != nil {
+		reportFailure(story, err)
+		os.Exit(1)
+	}
+}
+
+func listCommand(args []string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	parseFlags(flags, args)
+
+	manifestPaths, _ := filepath.Glob("./images/*/story.json")
+	if len(manifestPaths) == 0 {
+		fmt.Println("We haven't written anything yet.")
+		return
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tTITLE\tABOUT\tPAGES\tOUTPUTS")
+	for _, manifestPath := range manifestPaths {
+		story, err := loadManifest(filepath.Base(filepath.Dir(manifestPath)))
+		if err != nil {
+			continue
+		}
+		finished := 0
+		for index := range story.Pages {
+			if pageIsComplete(&story.Pages[index]) {
+				finished++
+			}
+		}
+		outputs := make([]string, 0, len(story.Outputs))
+		for name := range story.Outputs {
+			outputs = append(outputs, name)
+		}
+		sort.Strings(outputs)
+		fmt.Fprintf(
+			writer,
+			"%s\t%s\t%s the %s\t%d/%d\t%s\n",
+			story.Id,
+			story.Title,
+			story.Synopsis.Name,
+			story.Synopsis.Animal,
+			finished,
+			len(story.Paragraphs),
+			strings.Join(outputs, ","),
+		)
+	}
+	writer.Flush()
+}
+
+// With just a page it lists the pictures drawn for it, given a candidate too
+// it swaps that one into the book.
+func selectCommand(args []string) {
+	flags := flag.NewFlagSet("select", flag.ExitOnError)
+	positional := parseFlags(flags, args)
+
+	story := loadStoryArgument(flags.Name(), positional)
+	if len(positional) < 2 {
+		fmt.Printf("Which page? Try \"storybook select %s <page> [candidate]\".\n", story.Id)
+		os.Exit(2)
+	}
+	pageNumber, err := strconv.Atoi(positional[1])
+	if err != nil || pageNumber < 1 || pageNumber > len(story.Pages) {
+		fmt.Printf("There's no page %s, it has %d.\n", positional[1], len(story.Pages))
+		os.Exit(2)
+	}
+	page := &story.Pages[pageNumber-1]
+	if len(page.Candidates) == 0 {
+		fmt.Println("That page only ever had the one picture.")
+		os.Exit(1)
+	}
+
+	if len(positional) < 3 {
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "CANDIDATE\tSCORE\tSEED\tPATH\t")
+		for index, candidate := range page.Candidates {
+			selected := ""
+			if index == page.Selected {
+				selected = "(selected)"
+			}
+			fmt.Fprintf(writer, "%d\t%.3f\t%d\t%s\t%s\n", index+1, candidate.Score, candidate.Seed, candidate.Path, selected)
+		}
+		writer.Flush()
+		return
+	}
+	candidateNumber, err := strconv.Atoi(positional[2])
+	if err != nil || candidateNumber < 1 || candidateNumber > len(page.Candidates) {
+		fmt.Printf("There's no candidate %s, page %d has %d.\n", positional[2], pageNumber, len(page.Candidates))
+		os.Exit(2)
+	}
+	if !fileExists(page.Candidates[candidateNumber-1].Path) {
+		fmt.Println("Hrm. That picture isn't where I left it.")
+		os.Exit(1)
+	}
+	if page.Selected != candidateNumber-1 {
+		selectCandidate(page, candidateNumber-1)
+		forgetOutputs(story)
+	}
+	saveManifest(story)
+	fmt.Printf("Page %d uses candidate %d now. Run \"storybook publish %s\" to put it in the book.\n", pageNumber, candidateNumber, story.Id)
+}
+
+// The flag package stops at the first positional argument, but people are
+// going to type "export <story-id> --format pdf" anyway.
+func parseFlags(flags *flag.FlagSet, args []string) []string {
+	positional := make([]string, 0)
+	for {
+		flags.Parse(args)
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	return positional
+}
+
+func loadStoryArgument(command string, positional []string) *Story {
+	if len(positional) < 1 {
+		fmt.Printf("Which story? Try \"storybook %s <story-id>\".\n", command)
+		os.Exit(2)
+	}
+	story, err := loadManifest(positional[0])
+	if err != nil {
+		if DEBUG {
+			panic(err)
+		}
+		fmt.Println("Hrm. I don't remember writing that one.")
+		os.Exit(1)
+	}
+
+	return story
+}
+
+func requireFinishedStory(story *Story) {
+	if len(story.Paragraphs) == 0 || len(story.Pages) != len(story.Paragraphs) {
+		fmt.Printf("That one isn't finished yet. Try \"storybook resume %s\" first.\n", story.Id)
+		os.Exit(1)
+	}
+	for index := range story.Pages {
+		if !pageIsComplete(&story.Pages[index]) {
+			fmt.Printf("That one isn't finished yet. Try \"storybook resume %s\" first.\n", story.Id)
+			os.Exit(1)
+		}
+	}
+}
+
+func printOutputs(story *Story) {
+	for _, publisher := range publishers {
+		tell(fmt.Sprintf("%s: %s", publisher.Name(), story.Outputs[publisher.Name()]))
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/gofor-little/env"
+	"gopkg.in/yaml.v3"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Config is everything Storybook can be told about how to run. It starts out
+// with the defaults, then gets whatever is in the config file, then anything
+// set in the environment (or .env), then whatever was passed on the command
+// line, each one winning over the last.
+type Config struct {
+	Debug      bool            `yaml:"debug"`
+	Publishers string          `yaml:"publishers"`
+	Text       TextConfig      `yaml:"text"`
+	Image      ImageConfig     `yaml:"image"`
+	Pages      PagesConfig     `yaml:"pages"`
+	OpenAI     OpenAIConfig    `yaml:"openai"`
+	Stability  StabilityConfig `yaml:"stability"`
+	AWS        AWSConfig       `yaml:"aws"`
+	Slides     SlidesConfig    `yaml:"slides"`
+	EPUB       EPUBConfig      `yaml:"epub"`
+	Prompts    PromptsConfig   `yaml:"prompts"`
+}
+
+type TextConfig struct {
+	Provider          string `yaml:"provider"`
+	Model             string `yaml:"model"`
+	URL               string `yaml:"url"`
+	RequestsPerMinute int    `yaml:"requests_per_minute"`
+}
+
+type ImageConfig struct {
+	Provider          string       `yaml:"provider"`
+	URL               string       `yaml:"url"`
+	RequestsPerMinute int          `yaml:"requests_per_minute"`
+	NegativePrompts   []string     `yaml:"negative_prompts"`
+	Weights           ImageWeights `yaml:"weights"`
+	Candidates        int          `yaml:"candidates"`
+	Scorer            string       `yaml:"scorer"`
+	ScorerURL         string       `yaml:"scorer_url"`
+}
+
+type PagesConfig struct {
+	Workers int `yaml:"workers"`
+}
+
+type OpenAIConfig struct {
+	Key string `yaml:"key"`
+}
+
+type StabilityConfig struct {
+	Key    string `yaml:"key"`
+	Engine string `yaml:"engine"`
+}
+
+type AWSConfig struct {
+	Bucket          string `yaml:"bucket"`
+	Region          string `yaml:"region"`
+	AccessKeyId     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+}
+
+type SlidesConfig struct {
+	FinalSlideImage string `yaml:"final_slide_image"`
+}
+
+type PromptsConfig struct {
+	Dir string `yaml:"dir"`
+}
+
+type EPUBConfig struct {
+	Author   string `yaml:"author"`
+	Language string `yaml:"language"`
+}
+
+func getDefaultConfig() Config {
+	return Config{
+		Publishers: "slides",
+		Text: TextConfig{
+			Provider:          "openai",
+			URL:               "http://localhost:11434/v1",
+			RequestsPerMinute: 60,
+		},
+		Image: ImageConfig{
+			Provider:          "stability",
+			URL:               "http://localhost:7860",
+			RequestsPerMinute: 30,
+			// Words in the pictures always come out garbled
+			NegativePrompts: []string{"text", "words", "letters", "writing", "watermark", "signature"},
+			Weights: ImageWeights{
+				Scene:     1,
+				Character: 0.8,
+				Style:     0.6,
+				Negative:  1,
+			},
+			Candidates: 1,
+			Scorer:     "heuristic",
+		},
+		Pages:     PagesConfig{Workers: 4},
+		Stability: StabilityConfig{Engine: "stable-diffusion-xl-1024-v1-0"},
+		EPUB: EPUBConfig{
+			Author:   "Storybook",
+			Language: "en",
+		},
+		Prompts: PromptsConfig{Dir: "./prompts"},
+	}
+}
+
+// The config file is ./storybook.yaml unless --config or STORYBOOK_CONFIG
+// says otherwise. It's fine for the default one not to exist.
+func loadConfig(path string) (Config, error) {
+	config := getDefaultConfig()
+	env.Load("./.env")
+	required := path != ""
+	if path == "" {
+		path = env.Get("STORYBOOK_CONFIG", "")
+		required = path != ""
+	}
+	if path == "" {
+		path = "./storybook.yaml"
+	}
+
+	configBytes, err := os.ReadFile(path)
+	if err != nil && (required || !os.IsNotExist(err)) {
+		return config, err
+	}
+	if err == nil {
+		err = yaml.Unmarshal(configBytes, &config)
+		if err != nil {
+			return config, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return config, applyEnvironment(&config)
+}
+
+// The environment variables are the same ones Storybook has always read. An
+// empty one (like the blanks in .env.example) doesn't count as set.
+func applyEnvironment(config *Config) error {
+	settings := map[string]*string{
+		"OPEN_AI_KEY":           &config.OpenAI.Key,
+		"STABILITY_API_KEY":     &config.Stability.Key,
+		"STABILITY_ENGINE":      &config.Stability.Engine,
+		"S3_BUCKET_NAME":        &config.AWS.Bucket,
+		"AWS_REGION":            &config.AWS.Region,
+		"AWS_ACCESS_KEY_ID":     &config.AWS.AccessKeyId,
+		"AWS_SECRET_ACCESS_KEY": &config.AWS.SecretAccessKey,
+		"FINAL_SLIDE_IMAGE":     &config.Slides.FinalSlideImage,
+		"TEXT_PROVIDER":         &config.Text.Provider,
+		"TEXT_MODEL":            &config.Text.Model,
+		"LOCAL_TEXT_URL":        &config.Text.URL,
+		"IMAGE_PROVIDER":        &config.Image.Provider,
+		"LOCAL_IMAGE_URL":       &config.Image.URL,
+		"IMAGE_SCORER":          &config.Image.Scorer,
+		"IMAGE_SCORER_URL":      &config.Image.ScorerURL,
+		"PUBLISHERS":            &config.Publishers,
+		"EPUB_AUTHOR":           &config.EPUB.Author,
+		"EPUB_LANGUAGE":         &config.EPUB.Language,
+		"PROMPTS_DIR":           &config.Prompts.Dir,
+	}
+	for key, value := range settings {
+		if setting := os.Getenv(key); setting != "" {
+			*value = setting
+		}
+	}
+
+	ints := map[string]*int{
+		"PAGE_WORKERS":           &config.Pages.Workers,
+		"TEXT_REQUESTS_PER_MIN":  &config.Text.RequestsPerMinute,
+		"IMAGE_REQUESTS_PER_MIN": &config.Image.RequestsPerMinute,
+		"IMAGE_CANDIDATES":       &config.Image.Candidates,
+	}
+	for key, value := range ints {
+		if setting := os.Getenv(key); setting != "" {
+			number, err := strconv.Atoi(setting)
+			if err != nil {
+				return fmt.Errorf("%s should be a number, not %q", key, setting)
+			}
+			*value = number
+		}
+	}
+
+	if setting := os.Getenv("IMAGE_NEGATIVE_PROMPTS"); setting != "" {
+		config.Image.NegativePrompts = splitPromptList(setting)
+	}
+
+	if setting := os.Getenv("DEBUG"); setting != "" {
+		config.Debug = strings.ToLower(setting) == "true"
+	}
+
+	return nil
+}
+
+// Copies the config out to the globals the rest of Storybook reads from.
+func applyConfig(config Config) {
+	DEBUG = config.Debug
+	OPEN_AI_KEY = config.OpenAI.Key
+	STABILITY_API_KEY = config.Stability.Key
+	STABILITY_ENGINE = config.Stability.Engine
+	S3_BUCKET_NAME = config.AWS.Bucket
+	AWS_REGION = config.AWS.Region
+	AWS_ACCESS_KEY_ID = config.AWS.AccessKeyId
+	AWS_SECRET_ACCESS_KEY = config.AWS.SecretAccessKey
+	FINAL_SLIDE_IMAGE = config.Slides.FinalSlideImage
+	TEXT_PROVIDER = strings.ToLower(config.Text.Provider)
+	TEXT_MODEL = config.Text.Model
+	LOCAL_TEXT_URL = config.Text.URL
+	TEXT_REQUESTS_PER_MIN = config.Text.RequestsPerMinute
+	IMAGE_PROVIDER = strings.ToLower(config.Image.Provider)
+	LOCAL_IMAGE_URL = config.Image.URL
+	IMAGE_REQUESTS_PER_MIN = config.Image.RequestsPerMinute
+	IMAGE_NEGATIVE_PROMPTS = config.Image.NegativePrompts
+	IMAGE_WEIGHTS = config.Image.Weights
+	IMAGE_CANDIDATES = config.Image.Candidates
+	IMAGE_SCORER = strings.ToLower(config.Image.Scorer)
+	IMAGE_SCORER_URL = config.Image.ScorerURL
+	PAGE_WORKERS = config.Pages.Workers
+	PUBLISHERS = config.Publishers
+	EPUB_AUTHOR = config.EPUB.Author
+	EPUB_LANGUAGE = config.EPUB.Language
+	PROMPTS_DIR = config.Prompts.Dir
+}
+
+// Only the things this run is actually going to use have to be set up, so
+// writing a PDF with the fake providers doesn't need a single key.
+func validateConfig(useProviders bool, publisherNames []string) []string {
+	problems := make([]string, 0)
+	require := func(value string, name string, reason string) {
+		if strings.TrimSpace(value) == "" {
+			problems = append(problems, fmt.Sprintf("%s is needed %s", name, reason))
+		}
+	}
+
+	if useProviders {
+		switch TEXT_PROVIDER {
+		case "openai":
+			require(OPEN_AI_KEY, "OPEN_AI_KEY (openai.key)", "to write with OpenAI")
+		case "local":
+			require(LOCAL_TEXT_URL, "LOCAL_TEXT_URL (text.url)", "to write with a local model")
+		case "fake":
+		default:
+			problems = append(problems, fmt.Sprintf("%q isn't a text provider, try openai, local or fake", TEXT_PROVIDER))
+		}
+		switch IMAGE_PROVIDER {
+		case "stability":
+			require(STABILITY_API_KEY, "STABILITY_API_KEY (stability.key)", "to draw with Stability")
+			require(STABILITY_ENGINE, "STABILITY_ENGINE (stability.engine)", "to draw with Stability")
+		case "dalle":
+			require(OPEN_AI_KEY, "OPEN_AI_KEY (openai.key)", "to draw with DALL·E")
+		case "local":
+			require(LOCAL_IMAGE_URL, "LOCAL_IMAGE_URL (image.url)", "to draw with a local model")
+		case "placeholder":
+		default:
+			problems = append(problems, fmt.Sprintf("%q isn't an image provider, try stability, dalle, local or placeholder", IMAGE_PROVIDER))
+		}
+		if IMAGE_WEIGHTS.Scene <= 0 {
+			problems = append(problems, "image.weights.scene has to be more than 0 or there's nothing to draw")
+		}
+		if IMAGE_WEIGHTS.Character < 0 || IMAGE_WEIGHTS.Style < 0 || IMAGE_WEIGHTS.Negative < 0 {
+			problems = append(problems, "image.weights can't be negative, use 0 to leave a part out")
+		}
+		// Stability and DALL·E won't draw more than 10 at a time
+		if IMAGE_CANDIDATES < 1 || IMAGE_CANDIDATES > 10 {
+			problems = append(problems, "IMAGE_CANDIDATES (image.candidates) has to be from 1 to 10")
+		}
+		switch IMAGE_SCORER {
+		case "clip":
+			require(IMAGE_SCORER_URL, "IMAGE_SCORER_URL (image.scorer_url)", "to score pictures with a similarity service")
+		case "heuristic", "first":
+		default:
+			problems = append(problems, fmt.Sprintf("%q isn't an image scorer, try heuristic, clip or first", IMAGE_SCORER))
+		}
+	}
+
+	for _, name := range publisherNames {
+		switch name {
+		case "slides":
+			require(S3_BUCKET_NAME, "S3_BUCKET_NAME (aws.bucket)", "to put the pictures where Slides can see them")
+			require(AWS_REGION, "AWS_REGION (aws.region)", "to put the pictures where Slides can see them")
+			require(FINAL_SLIDE_IMAGE, "FINAL_SLIDE_IMAGE (slides.final_slide_image)", "for the last slide")
+			if !fileExists("./credentials.json") {
+				problems = append(problems, "./credentials.json is needed to sign in to Google Slides")
+			}
+		case "dryrun", "pdf", "epub", "site":
+		default:
+			problems = append(problems, fmt.Sprintf("%q isn't a publisher, try slides, dryrun, pdf, epub or site", name))
+		}
+	}
+
+	return problems
+}
+
+// Stops the run before anything gets spent if the config can't carry it.
+func requireValidConfig(useProviders bool, publisherNames []string) {
+	problems := validateConfig(useProviders, publisherNames)
+	if len(problems) == 0 {
+		return
+	}
+	fmt.Println("I can't get started without a few things:")
+	for _, problem := range problems {
+		fmt.Printf("  - %s\n", problem)
+	}
+	os.Exit(2)
+}
+
+func getPublisherNames(names string) []string {
+	publisherNames := make([]string, 0)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			publisherNames = append(publisherNames, name)
+		}
+	}
+
+	return publisherNames
+}
+
+// The providers can be picked on the command line too, for the commands that
+// generate anything.
+func addProviderFlags(flags *flag.FlagSet) (*string, *string) {
+	textProvider := flags.String("text-provider", TEXT_PROVIDER, "who writes the story: openai, local, or fake")
+	imageProvider := flags.String("image-provider", IMAGE_PROVIDER, "who draws the pictures: stability, dalle, local, or placeholder")
+
+	return textProvider, imageProvider
+}
+
+func applyProviderFlags(textProvider *string, imageProvider *string) {
+	TEXT_PROVIDER = strings.ToLower(*textProvider)
+	IMAGE_PROVIDER = strings.ToLower(*imageProvider)
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"html"
+	"os"
+	"text/template"
+	"time"
+)
+
+// EPUBPublisher writes a fixed layout EPUB 3 so each page of the book shows
+// up as one screen on an e-reader, picture and all.
+type EPUBPublisher struct{}
+
+type epubPage struct {
+	Id        string
+	FileName  string
+	Title     string
+	ImageName string
+	Text      string
+}
+
+type epubData struct {
+	Id        string
+	Title     string
+	Author    string
+	Language  string
+	Modified  string
+	CoverName string
+	Pages     []epubPage
+	Width     int
+	Height    int
+}
+
+// Everything in an EPUB is XML, which html/template won't write for us, so
+// anything that came from the story gets escaped by hand.
+var epubFuncs = template.FuncMap{
+	"xml": html.EscapeString,
+}
+
+var epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+var epubPackageTemplate = template.Must(template.New("content.opf").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" prefix="rendition: http://www.idpf.org/vocab/rendition/#">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">urn:uuid:{{.Id}}</dc:identifier>
+    <dc:title>{{xml .Title}}</dc:title>
+    <dc:creator>{{xml .Author}}</dc:creator>
+    <dc:language>{{xml .Language}}</dc:language>
+    <meta property="dcterms:modified">{{.Modified}}</meta>
+    <meta property="rendition:layout">pre-paginated</meta>
+    <meta property="rendition:orientation">landscape</meta>
+    <meta property="rendition:spread">none</meta>
+    <meta name="cover" content="cover-image"/>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="style" href="style.css" media-type="text/css"/>
+    <item id="cover-image" href="images/{{.CoverName}}" media-type="image/png" properties="cover-image"/>
+    <item id="cover" href="cover.xhtml" media-type="application/xhtml+xml"/>
+    {{- range .Pages}}
+    <item id="{{.Id}}" href="{{.FileName}}" media-type="application/xhtml+xml"/>
+    <item id="{{.Id}}-image" href="images/{{.ImageName}}" media-type="image/png"/>
+    {{- end}}
+    <item id="final" href="final.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine>
+    <itemref idref="cover"/>
+    {{- range .Pages}}
+    <itemref idref="{{.Id}}"/>
+    {{- end}}
+    <itemref idref="final"/>
+  </spine>
+</package>
+`))
+
+var epubNavTemplate = template.Must(template.New("nav.xhtml").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="{{xml .Language}}" xml:lang="{{xml .Language}}">
+<head>
+  <title>{{xml .Title}}</title>
+</head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <h1>{{xml .Title}}</h1>
+    <ol>
+      <li><a href="cover.xhtml">{{xml .Title}}</a></li>
+      {{- range .Pages}}
+      <li><a href="{{.FileName}}">{{xml .Title}}</a></li>
+      {{- end}}
+      <li><a href="final.xhtml">Made With Storybook</a></li>
+    </ol>
+  </nav>
+</body>
+</html>
+`))
+
+var epubCoverTemplate = template.Must(template.New("cover.xhtml").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="{{xml .Language}}" xml:lang="{{xml .Language}}">
+<head>
+  <title>{{xml .Title}}</title>
+  <meta name="viewport" content="width={{.Width}}, height={{.Height}}"/>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body epub:type="cover">
+  <div class="page">
+    <img class="illustration" src="images/{{.CoverName}}" alt="{{xml .Title}}"/>
+    <div class="title"><h1>{{xml .Title}}</h1></div>
+  </div>
+</body>
+</html>
+`))
+
+var epubPageTemplate = template.Must(template.New("page.xhtml").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" lang="{{xml .Language}}" xml:lang="{{xml .Language}}">
+<head>
+  <title>{{xml .Page.Title}}</title>
+  <meta name="viewport" content="width={{.Width}}, height={{.Height}}"/>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+  <div class="page">
+    <img class="illustration" src="images/{{.Page.ImageName}}" alt=""/>
+    <div class="paragraph"><p>{{xml .Page.Text}}</p></div>
+  </div>
+</body>
+</html>
+`))
+
+var epubFinalTemplate = template.Must(template.New("final.xhtml").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" lang="{{xml .Language}}" xml:lang="{{xml .Language}}">
+<head>
+  <title>Made With Storybook</title>
+  <meta name="viewport" content="width={{.Width}}, height={{.Height}}"/>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+  <div class="page final">
+    <p class="made-with">Made With</p>
+    <p class="storybook">Storybook</p>
+    <a class="button" href="https://github.com/MATTALUI/storybook">How It Works</a>
+    <a class="button" href="https://github.com/MATTALUI/storybook">Source</a>
+    <a class="button" href="https://github.com/MATTALUI/storybook">Version 0.1.0</a>
+  </div>
+</body>
+</html>
+`))
+
+var epubStyle = `html, body { margin: 0; padding: 0; }
+.page { position: relative; width: 1344px; height: 768px; overflow: hidden; background: #fff; }
+.illustration { position: absolute; top: 0; left: 0; width: 1344px; height: 768px; }
+.title { position: absolute; top: 0; left: 0; width: 1344px; height: 768px; display: table; background: rgba(94, 94, 94, 0.5); }
+.title h1 { display: table-cell; vertical-align: middle; text-align: center; color: #fff; font-size: 140px; font-family: "Pacifico", cursive; padding: 0 60px; }
+.paragraph { position: absolute; top: 28px; left: 28px; width: 474px; height: 644px; padding: 14px; background: rgba(94, 94, 94, 0.69); border: 2px solid #595959; }
+.paragraph p { margin: 0; color: #fff; font-weight: bold; font-size: 26px; font-family: sans-serif; }
+.final { padding: 40px 44px; box-sizing: border-box; }
+.made-with { margin: 0; font-size: 36px; font-family: "Changa One", sans-serif; }
+.storybook { margin: 0 0 40px 0; font-size: 150px; font-weight: bold; font-family: "Pacifico", cursive; }
+.button { display: block; width: 416px; margin-bottom: 20px; padding: 20px 0; border-radius: 16px; background: rgba(237, 237, 237, 0.85); color: #000; text-align: center; text-decoration: none; font-size: 26px; font-family: "Changa One", sans-serif; }
+`
+
+func (publisher *EPUBPublisher) Name() string {
+	return "epub"
+}
+
+func (publisher *EPUBPublisher) Publish(ctx context.Context, story *Story) (string, error) {
+	say("Let me bind this for your e-reader...")
+	coverPath := story.CoverImagePath
+	if coverPath == "" {
+		coverPath = fmt.Sprintf("./images/%s/cover.png", story.Id)
+	}
+	data := epubData{
+		Id:        story.Id.String(),
+		Title:     story.Title,
+		Author:    EPUB_AUTHOR,
+		Language:  EPUB_LANGUAGE,
+		Modified:  time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		CoverName: "cover.png",
+		Pages:     make([]epubPage, 0, len(story.Pages)),
+		Width:     1344,
+		Height:    768,
+	}
+	for index, page := range story.Pages {
+		data.Pages = append(data.Pages, epubPage{
+			Id:        fmt.Sprintf("page-%d", index+1),
+			FileName:  fmt.Sprintf("page-%d.xhtml", index+1),
+			Title:     fmt.Sprintf("Page %d", index+1),
+			ImageName: fmt.Sprintf("page-%d.png", index+1),
+			Text:      page.Paragraph,
+		})
+	}
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+
+	// The mimetype has to be the very first thing in the file and it can't
+	// be compressed or readers won't recognize it. Writing it raw also keeps
+	// the zip writer from tacking a data descriptor onto it.
+	mimetypeBytes := []byte("application/epub+zip")
+	mimetype, err := archive.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(mimetypeBytes),
+		CompressedSize64:   uint64(len(mimetypeBytes)),
+		UncompressedSize64: uint64(len(mimetypeBytes)),
+	})
+	if err != nil {
+		return "", err
+	}
+	mimetype.Write(mimetypeBytes)
+
+	err = addEPUBFile(archive, "META-INF/container.xml", []byte(epubContainer))
+	if err != nil {
+		return "", err
+	}
+	err = addEPUBFile(archive, "OEBPS/style.css", []byte(epubStyle))
+	if err != nil {
+		return "", err
+	}
+	templates := []struct {
+		Name     string
+		Template *template.Template
+	}{
+		{Name: "OEBPS/content.opf", Template: epubPackageTemplate},
+		{Name: "OEBPS/nav.xhtml", Template: epubNavTemplate},
+		{Name: "OEBPS/cover.xhtml", Template: epubCoverTemplate},
+		{Name: "OEBPS/final.xhtml", Template: epubFinalTemplate},
+	}
+	for _, file := range templates {
+		err = addEPUBTemplate(archive, file.Name, file.Template, data)
+		if err != nil {
+			return "", err
+		}
+	}
+	err = addEPUBImage(archive, "OEBPS/images/"+data.CoverName, coverPath)
+	if err != nil {
+		return "", err
+	}
+	for index, page := range data.Pages {
+		err = addEPUBTemplate(archive, "OEBPS/"+page.FileName, epubPageTemplate, map[string]interface{}{
+			"Language": data.Language,
+			"Width":    data.Width,
+			"Height":   data.Height,
+			"Page":     page,
+		})
+		if err != nil {
+			return "", err
+		}
+		err = addEPUBImage(archive, "OEBPS/images/"+page.ImageName, story.Pages[index].ImagePath)
+		if err != nil {
+			return "", err
+		}
+	}
+	err = archive.Close()
+	if err != nil {
+		return "", err
+	}
+
+	os.MkdirAll(fmt.Sprintf("./images/%s", story.Id), os.ModePerm)
+	filePath := fmt.Sprintf("./images/%s/story.epub", story.Id)
+	err = os.WriteFile(filePath, buffer.Bytes(), 0644)
+	if err != nil {
+		return "", err
+	}
+	tell(fmt.Sprintf("Your e-book is ready at %s", filePath))
+
+	return filePath, nil
+}
+
+func addEPUBFile(archive *zip.Writer, name string, contents []byte) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(contents)
+
+	return err
+}
+
+func addEPUBTemplate(archive *zip.Writer, name string, tmpl *template.Template, data interface{}) error {
+	var buffer bytes.Buffer
+	err := tmpl.Execute(&buffer, data)
+	if err != nil {
+		return err
+	}
+
+	return addEPUBFile(archive, name, buffer.Bytes())
+}
+
+func addEPUBImage(archive *zip.Writer, name string, path string) error {
+	imageBytes, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return addEPUBFile(archive, name, imageBytes)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTitleFormat           = errors.New("the title didn't come back formatted like TITLE: \"...\"")
+	ErrStoryFormat           = errors.New("the story didn't come back the way it was asked for")
+	ErrStructuredUnsupported = errors.New("the text provider can't answer in JSON")
+	ErrImageGeneration       = errors.New("image generation failed")
+	ErrImageFiltered         = errors.New("the image provider wouldn't draw it")
+)
+
+// ImageGenerationError is what an image provider hands back when it answers
+// with something other than a picture.
+type ImageGenerationError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+}
+
+func (err *ImageGenerationError) Error() string {
+	return fmt.Sprintf("%s answered %d: %s", err.Provider, err.StatusCode, strings.TrimSpace(err.Body))
+}
+
+func (err *ImageGenerationError) Is(target error) bool {
+	return target == ErrImageGeneration
+}
+
+// StageError says which part of the pipeline something went wrong in. Page is
+// the 1-based page number for the per-page stages and 0 otherwise.
+type StageError struct {
+	Stage string
+	Page  int
+	Err   error
+}
+
+func (err *StageError) Error() string {
+	if err.Page > 0 {
+		return fmt.Sprintf("%s (page %d): %s", err.Stage, err.Page, err.Err)
+	}
+
+	return fmt.Sprintf("%s: %s", err.Stage, err.Err)
+}
+
+func (err *StageError) Unwrap() error {
+	return err.Err
+}
+
+// StageErrors collects the failures from stages that run side by side, like
+// the pages, so one bad page doesn't hide the others.
+type StageErrors []*StageError
+
+func (errs StageErrors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (errs StageErrors) orNil() error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+var stageQuips = map[string]string{
+	"story":             "Hrm. I actually can't think of a story like that. Try again later!",
+	"reading level":     "I can't seem to put this in words they'd understand. Try again later?",
+	"character":         "I can't picture what they look like. Try again later?",
+	"title":             "Eh. I've got a foggy brain right now. I can't think of a title.",
+	"cover":             "I messed up making the cover. It's worthless now.",
+	"page description":  "I'm actually having a hard time picturing this. Let's try again later",
+	"page illustration": "This art didn't turn out the way I wanted. Maybe we should try again later.",
+	"upload":            "You know, I am having trouble posting these images. Hrm. Try again later?",
+	"publish":           "Ugh. I couldn't get this out the door. Try again later?",
+}
+
+// How long each stage gets, retries and all, before we give up on it. Image
+// generation is slow on a good day.
+var stageTimeouts = map[string]time.Duration{
+	"story":             5 * time.Minute,
+	"reading level":     2 * time.Minute,
+	"character":         2 * time.Minute,
+	"title":             2 * time.Minute,
+	"cover":             5 * time.Minute,
+	"page description":  2 * time.Minute,
+	"page illustration": 5 * time.Minute,
+	"upload":            3 * time.Minute,
+	"publish":           10 * time.Minute,
+}
+
+// Runs a stage under its deadline. The API calls inside it already retry
+// whatever is flaky, so all that's left to retry here is an answer that came
+// back but wasn't any good.
+func runStage(ctx context.Context, stage string, page int, fn func(ctx context.Context) error) error {
+	stageCtx, run := startStage(ctx, stage, page, "")
+	stageCtx, cancel := context.WithTimeout(stageCtx, stageTimeouts[stage])
+	defer cancel()
+	err := answerRetryPolicy.Do(stageCtx, fn)
+	if err == nil {
+		run.finish(nil)
+		return nil
+	}
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	run.finish(err)
+
+	return &StageError{Stage: stage, Page: page, Err: err}
+}
+
+// Everything that went wrong gets its quip, and since the manifest has
+// everything up to that point the story can be picked back up. What actually
+// went wrong goes in the manifest too, for batch to put in its report.
+func reportFailure(story *Story, err error) {
+	story.Failure = err.Error()
+	saveManifest(story)
+	stageErrs := StageErrors{}
+	if !errors.As(err, &stageErrs) {
+		stageErr := &StageError{Stage: "unknown", Err: err}
+		errors.As(err, &stageErr)
+		stageErrs = StageErrors{stageErr}
+	}
+
+	lines := []string{""}
+	quipped := make(map[string]bool)
+	for _, stageErr := range stageErrs {
+		if errors.Is(stageErr, context.Canceled) {
+			lines = append(lines, "Alright, alright. I'll stop here.")
+			break
+		}
+		quip := getStageQuip(stageErr)
+		if !quipped[quip] {
+			lines = append(lines, quip)
+			quipped[quip] = true
+		}
+		if DEBUG {
+			lines = append(lines, fmt.Sprintf("  %s", stageErr))
+		}
+	}
+	lines = append(lines, fmt.Sprintf("Everything up to there is saved. Try \"storybook resume %s\" to pick it back up.", story.Id))
+	tell(strings.Join(lines, "\n"))
+}
+
+func getStageQuip(err *StageError) string {
+	// Publishing fails for all kinds of reasons, the more specific one wins
+	var inner *StageError
+	if errors.As(err.Err, &inner) {
+		return getStageQuip(inner)
+	}
+	if quip, ok := stageQuips[err.Stage]; ok {
+		return quip
+	}
+
+	return "Something went wrong and I'm not even sure what. Try again later?"
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type ImagePrompt struct {
+	Text   string
+	Weight float64
+}
+
+// With an InitImage the picture starts from that one instead of from noise,
+// and InitImageStrength (0 to 1) is how much of it should survive.
+type ImageRequest struct {
+	Prompts           []ImagePrompt
+	Width             int
+	Height            int
+	Seed              int
+	Samples           int
+	InitImage         []byte
+	InitImageStrength float64
+	StylePreset       string
+}
+
+type GeneratedImage struct {
+	Bytes        []byte
+	Seed         int
+	FinishReason string
+}
+
+type ImageGenerator interface {
+	GenerateImages(ctx context.Context, request ImageRequest) ([]GeneratedImage, error)
+}
+
+// Splits the weighted prompts into the plain positive and negative text that
+// backends without prompt weighting expect.
+func splitImagePrompts(prompts []ImagePrompt) (string, string) {
+	positive := make([]string, 0)
+	negative := make([]string, 0)
+	for _, prompt := range prompts {
+		if prompt.Weight < 0 {
+			negative = append(negative, prompt.Text)
+		} else {
+			positive = append(positive, prompt.Text)
+		}
+	}
+
+	return strings.Join(positive, ". "), strings.Join(negative, ", ")
+}
+
+// A1111 has no separate weights but reads them out of the prompt itself,
+// written like "(a red scarf:0.8)".
+func weightImagePrompts(prompts []ImagePrompt) []ImagePrompt {
+	weighted := make([]ImagePrompt, 0, len(prompts))
+	for _, prompt := range prompts {
+		weight := math.Abs(prompt.Weight)
+		if weight != 1 {
+			prompt.Text = fmt.Sprintf("(%s:%s)", prompt.Text, strconv.FormatFloat(weight, 'f', -1, 64))
+		}
+		weighted = append(weighted, prompt)
+	}
+
+	return weighted
+}
+
+type StabilityTextPrompt struct {
+	Text   string  `json:"text"`
+	Weight float64 `json:"weight"`
+}
+
+type StabilityRequestBody struct {
+	Steps       int                   `json:"steps"`
+	Width       int                   `json:"width"`
+	Height      int                   `json:"height"`
+	Seed        int                   `json:"seed"`
+	CFGScale    int                   `json:"cfg_scale"`
+	Samples     int                   `json:"samples"`
+	StylePreset string                `json:"style_preset,omitempty"`
+	TextPrompts []StabilityTextPrompt `json:"text_prompts"`
+}
+
+type StabilityResponseArtifact struct {
+	Base64Image  string `json:"base64"`
+	FinishReason string `json:"finishReason"`
+	Seed         int    `json:"seed"`
+}
+
+type StabilityResponseBody struct {
+	Artifacts []StabilityResponseArtifact `json:"artifacts"`
+}
+
+type StabilityImageGenerator struct {
+	Key    string
+	Engine string
+}
+
+func (generator *StabilityImageGenerator) GenerateImages(ctx context.Context, request ImageRequest) ([]GeneratedImage, error) {
+	var r *http.Request
+	if len(request.InitImage) > 0 {
+		r = generator.newImageToImageRequest(ctx, request)
+	} else {
+		postUrl := fmt.Sprintf("https://api.stability.ai/v1/generation/%s/text-to-image", generator.Engine)
+		prompts := make([]StabilityTextPrompt, 0, len(request.Prompts))
+		for _, prompt := range request.Prompts {
+			prompts = append(prompts, StabilityTextPrompt{Text: prompt.Text, Weight: prompt.Weight})
+		}
+		bodyData := StabilityRequestBody{
+			Steps:       40,
+			Width:       request.Width,
+			Height:      request.Height,
+			Seed:        request.Seed,
+			CFGScale:    10,
+			Samples:     request.Samples,
+			StylePreset: request.StylePreset,
+			TextPrompts: prompts,
+		}
+		postBody, _ := json.Marshal(bodyData)
+		r, _ = http.NewRequestWithContext(ctx, "POST", postUrl, bytes.NewBuffer(postBody))
+		r.Header.Add("content-type", "application/json")
+	}
+	r.Header.Add("Accept", "application/json")
+	r.Header.Add("Stability-Client-ID", "storybook")
+	r.Header.Add("Authorization", fmt.Sprintf("Bearer %s", generator.Key))
+	res, err := httpClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		b, _ := io.ReadAll(res.Body)
+		return nil, &ImageGenerationError{Provider: "stability", StatusCode: res.StatusCode, Body: string(b)}
+	}
+	results := &StabilityResponseBody{}
+	err = json.NewDecoder(res.Body).Decode(results)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]GeneratedImage, 0, len(results.Artifacts))
+	for _, artifact := range results.Artifacts {
+		imageBytes, err := base64.StdEncoding.DecodeString(artifact.Base64Image)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, GeneratedImage{
+			Bytes:        imageBytes,
+			Seed:         artifact.Seed,
+			FinishReason: artifact.FinishReason,
+		})
+	}
+
+	return images, nil
+}
+
+// Image to image is a multipart form instead of JSON, and the size comes
+// from the init image.
+func (generator *StabilityImageGenerator) newImageToImageRequest(ctx context.Context, request ImageRequest) *http.Request {
+	postUrl := fmt.Sprintf("https://api.stability.ai/v1/generation/%s/image-to-image", generator.Engine)
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	initImage, _ := form.CreateFormFile("init_image", "init.png")
+	initImage.Write(request.InitImage)
+	form.WriteField("init_image_mode", "IMAGE_STRENGTH")
+	form.WriteField("image_strength", strconv.FormatFloat(request.InitImageStrength, 'f', 2, 64))
+	form.WriteField("steps", "40")
+	form.WriteField("seed", strconv.Itoa(request.Seed))
+	form.WriteField("cfg_scale", "10")
+	form.WriteField("samples", strconv.Itoa(request.Samples))
+	if request.StylePreset != "" {
+		form.WriteField("style_preset", request.StylePreset)
+	}
+	for index, prompt := range request.Prompts {
+		form.WriteField(fmt.Sprintf("text_prompts[%d][text]", index), prompt.Text)
+		form.WriteField(fmt.Sprintf("text_prompts[%d][weight]", index), strconv.FormatFloat(prompt.Weight, 'f', -1, 64))
+	}
+	form.Close()
+	r, _ := http.NewRequestWithContext(ctx, "POST", postUrl, &body)
+	r.Header.Add("content-type", form.FormDataContentType())
+
+	return r
+}
+
+// DALL·E only knows about square sizes and has no idea what a seed, a
+// negative prompt or an init image is, so those are dropped on the floor.
+type DalleImageGenerator struct {
+	Client *openai.Client
+}
+
+func (generator *DalleImageGenerator) GenerateImages(ctx context.Context, request ImageRequest) ([]GeneratedImage, error) {
+	prompt, _ := splitImagePrompts(request.Prompts)
+	resp, err := generator.Client.CreateImage(
+		ctx,
+		openai.ImageRequest{
+			Prompt:         prompt,
+			N:              request.Samples,
+			Size:           openai.CreateImageSize1024x1024,
+			ResponseFormat: openai.CreateImageResponseFormatB64JSON,
+		},
+	)
+	apiErr := &openai.APIError{}
+	if errors.As(err, &apiErr) {
+		return nil, &ImageGenerationError{Provider: "dalle", StatusCode: apiErr.HTTPStatusCode, Body: apiErr.Message}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]GeneratedImage, 0, len(resp.Data))
+	for _, data := range resp.Data {
+		imageBytes, err := base64.StdEncoding.DecodeString(data.B64JSON)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, GeneratedImage{
+			Bytes:        imageBytes,
+			FinishReason: "SUCCESS",
+		})
+	}
+
+	return images, nil
+}
+
+type LocalImageRequestBody struct {
+	Prompt         string `json:"prompt"`
+	NegativePrompt string `json:"negative_prompt"`
+	Steps          int    `json:"steps"`
+	Width          int    `json:"width"`
+	Height         int    `json:"height"`
+	Seed           int    `json:"seed"`
+	CFGScale       int    `json:"cfg_scale"`
+	BatchSize      int    `json:"batch_size"`
+	// Only for img2img
+	InitImages        []string `json:"init_images,omitempty"`
+	DenoisingStrength float64  `json:"denoising_strength,omitempty"`
+}
+
+type LocalImageResponseBody struct {
+	Images []string `json:"images"`
+	Info   string   `json:"info"`
+}
+
+type LocalImageResponseInfo struct {
+	Seed     int   `json:"seed"`
+	AllSeeds []int `json:"all_seeds"`
+}
+
+// LocalImageGenerator speaks the Automatic1111 web UI API, which ComfyUI and
+// friends can also serve through their compatibility layers.
+type LocalImageGenerator struct {
+	URL string
+}
+
+func (generator *LocalImageGenerator) GenerateImages(ctx context.Context, request ImageRequest) ([]GeneratedImage, error) {
+	endpoint := "txt2img"
+	prompt, negativePrompt := splitImagePrompts(weightImagePrompts(request.Prompts))
+	seed := request.Seed
+	if seed == 0 {
+		// 0 means "pick one for me" to Stability, A1111 wants -1
+		seed = -1
+	}
+	bodyData := LocalImageRequestBody{
+		Prompt:         prompt,
+		NegativePrompt: negativePrompt,
+		Steps:          40,
+		Width:          request.Width,
+		Height:         request.Height,
+		Seed:           seed,
+		CFGScale:       10,
+		BatchSize:      request.Samples,
+	}
+	if len(request.InitImage) > 0 {
+		// A1111 counts how much to change rather than how much to keep
+		endpoint = "img2img"
+		bodyData.InitImages = []string{base64.StdEncoding.EncodeToString(request.InitImage)}
+		bodyData.DenoisingStrength = 1 - request.InitImageStrength
+	}
+	postUrl := fmt.Sprintf("%s/sdapi/v1/%s", strings.TrimRight(generator.URL, "/"), endpoint)
+	postBody, _ := json.Marshal(bodyData)
+	r, _ := http.NewRequestWithContext(ctx, "POST", postUrl, bytes.NewBuffer(postBody))
+	r.Header.Add("content-type", "application/json")
+	res, err := httpClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		b, _ := io.ReadAll(res.Body)
+		return nil, &ImageGenerationError{Provider: generator.URL, StatusCode: res.StatusCode, Body: string(b)}
+	}
+	results := &LocalImageResponseBody{}
+	err = json.NewDecoder(res.Body).Decode(results)
+	if err != nil {
+		return nil, err
+	}
+	info := &LocalImageResponseInfo{}
+	json.Unmarshal([]byte(results.Info), info)
+
+	images := make([]GeneratedImage, 0, len(results.Images))
+	for index, rawImage := range results.Images {
+		imageBytes, err := base64.StdEncoding.DecodeString(rawImage)
+		if err != nil {
+			return nil, err
+		}
+		imageSeed := info.Seed
+		if index < len(info.AllSeeds) {
+			imageSeed = info.AllSeeds[index]
+		}
+		images = append(images, GeneratedImage{
+			Bytes:        imageBytes,
+			Seed:         imageSeed,
+			FinishReason: "SUCCESS",
+		})
+	}
+
+	return images, nil
+}
+
+// PlaceholderImageGenerator paints a solid block of color picked from the
+// prompt so tests get real PNGs without calling anybody. Given an init image
+// it mixes in that image's color, as much as the strength says.
+type PlaceholderImageGenerator struct{}
+
+func (generator *PlaceholderImageGenerator) GenerateImages(ctx context.Context, request ImageRequest) ([]GeneratedImage, error) {
+	prompt, _ := splitImagePrompts(request.Prompts)
+	images := make([]GeneratedImage, 0, request.Samples)
+	for sample := 0; sample < request.Samples; sample++ {
+		hash := fnv.New32a()
+		hash.Write([]byte(fmt.Sprintf("%s:%d:%d", prompt, request.Seed, sample)))
+		sum := hash.Sum32()
+		fill := color.RGBA{R: uint8(sum >> 16), G: uint8(sum >> 8), B: uint8(sum), A: 255}
+		if initImage, err := png.Decode(bytes.NewReader(request.InitImage)); err == nil {
+			fill = mixColors(fill, initImage.At(0, 0), request.InitImageStrength)
+		}
+
+		canvas := image.NewRGBA(image.Rect(0, 0, request.Width, request.Height))
+		draw.Draw(canvas, canvas.Bounds(), &image.Uniform{C: fill}, image.Point{}, draw.Src)
+		var buffer bytes.Buffer
+		err := png.Encode(&buffer, canvas)
+		if err != nil {
+			return nil, err
+		}
+		// Like the real ones, the seed it was given is the seed it used
+		seed := request.Seed
+		if seed == 0 {
+			seed = int(sum)
+		}
+		images = append(images, GeneratedImage{
+			Bytes:        buffer.Bytes(),
+			Seed:         seed,
+			FinishReason: "SUCCESS",
+		})
+	}
+
+	return images, nil
+}
+
+func mixColors(base color.RGBA, other color.Color, amount float64) color.RGBA {
+	r, g, b, _ := other.RGBA()
+	mix := func(from uint8, to uint32) uint8 {
+		return uint8(float64(from)*(1-amount) + float64(to>>8)*amount)
+	}
+
+	return color.RGBA{R: mix(base.R, r), G: mix(base.G, g), B: mix(base.B, b), A: 255}
+}
+
+func getImageGenerator() ImageGenerator {
+	switch IMAGE_PROVIDER {
+	case "stability":
+		return &StabilityImageGenerator{
+			Key:    STABILITY_API_KEY,
+			Engine: STABILITY_ENGINE,
+		}
+	case "dalle":
+		config := openai.DefaultConfig(OPEN_AI_KEY)
+		config.HTTPClient = httpClient
+		return &DalleImageGenerator{
+			Client: openai.NewClientWithConfig(config),
+		}
+	case "local":
+		return &LocalImageGenerator{
+			URL: LOCAL_IMAGE_URL,
+		}
+	case "placeholder":
+		return &PlaceholderImageGenerator{}
+	}
+	panic(fmt.Sprintf("unknown IMAGE_PROVIDER %q", IMAGE_PROVIDER))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+)
+
+// ImageWeights is how much each part of an image prompt counts. The scene is
+// what's happening on the page, the character and style are there to keep
+// every picture looking like the same book. A weight of 0 leaves that part
+// out, and negative prompts are sent with the negative of their weight.
+type ImageWeights struct {
+	Scene     float64 `yaml:"scene"`
+	Character float64 `yaml:"character"`
+	Style     float64 `yaml:"style"`
+	Negative  float64 `yaml:"negative"`
+}
+
+// Splits a comma separated list like "text, blurry, extra legs" up, dropping
+// the blanks.
+func splitPromptList(list string) []string {
+	terms := make([]string, 0)
+	for _, term := range strings.Split(list, ",") {
+		term = strings.TrimSpace(term)
+		if term != "" {
+			terms = append(terms, term)
+		}
+	}
+
+	return terms
+}
+
+// Everything a story's pictures should stay away from: the ones in the
+// config that go for every picture, the style's own, then the story's.
+func getNegativePrompts(synopsis StorySynopsis, style ArtStyle) []string {
+	terms := make([]string, 0)
+	seen := map[string]bool{}
+	add := func(list []string) {
+		for _, term := range list {
+			term = strings.TrimSpace(term)
+			key := strings.ToLower(term)
+			if term == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			terms = append(terms, term)
+		}
+	}
+	add(IMAGE_NEGATIVE_PROMPTS)
+	add(splitPromptList(style.Negative))
+	add(synopsis.Negative)
+
+	return terms
+}
+
+// Builds the weighted prompts for one picture out of its scene, the story's
+// character sheet and its art style, plus every negative prompt.
+func getImagePrompts(scene string, synopsis StorySynopsis, character CharacterSheet, style ArtStyle) ([]ImagePrompt, error) {
+	imagePrompts := make([]ImagePrompt, 0)
+	add := func(text string, weight float64) {
+		if weight != 0 && strings.TrimSpace(text) != "" {
+			imagePrompts = append(imagePrompts, ImagePrompt{Text: text, Weight: weight})
+		}
+	}
+
+	add(scene, IMAGE_WEIGHTS.Scene)
+	if !character.isEmpty() {
+		data := getPromptData(synopsis)
+		data.Character = character.Description
+		characterPrompt, err := renderPrompt("character_image", data)
+		if err != nil {
+			return nil, err
+		}
+		add(characterPrompt, IMAGE_WEIGHTS.Character)
+	}
+	add(style.Prompt, IMAGE_WEIGHTS.Style)
+	for _, negative := range getNegativePrompts(synopsis, style) {
+		add(negative, -IMAGE_WEIGHTS.Negative)
+	}
+
+	return imagePrompts, nil
+}
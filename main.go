@@ -2,133 +2,414 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"context"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
-	"github.com/gofor-little/env"
 	"github.com/google/uuid"
-	"github.com/sashabaranov/go-openai"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
-	"google.golang.org/api/option"
-	"google.golang.org/api/slides/v1"
-	"io"
 	"math/rand"
-	"net/http"
 	"os"
+	"os/signal"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
 type StorySynopsis struct {
-	Animal string
-	Name   string
-	Goal   string
+	Animal   string
+	Name     string
+	Goal     string
+	Style    string
+	Length   int
+	Audience string
+	// 0 lets every picture pick its own seed
+	Seed int
+	// How much of the cover every page starts from, 0 to draw them from scratch
+	FromCover float64
+	// What this story's pictures should stay away from, on top of the usual
+	Negative []string
 }
 
 type Page struct {
 	Id                uuid.UUID
 	Paragraph         string
 	ExcerptDescriptor string
+	IllustrationHint  string
 	ImageDescriptor   string
+	ImagePrompts      []ImagePrompt
 	ImagePath         string
+	Seed              int
 	PublicImagePath   string
+	// Every picture drawn for the page, and which one ImagePath is
+	Candidates []ImageCandidate
+	Selected   int
+	// The prompt versions this page was described and drawn with
+	Prompts map[string]PromptVersion
+	// How many times in a row every picture was filtered, so the next try
+	// doesn't ask for the exact same ones again
+	filtered int
 }
 
-type Story struct {
-	Id             uuid.UUID
-	Synopsis       StorySynopsis
-	Paragraphs     []string
-	RawGPTResponse string
-	Pages          []Page
-	Title          string
-	CoverImage     string
-}
-
-type StabilityTextPrompt struct {
-	Text   string `json:"text"`
-	Weight int    `json:"weight"`
+type ImageCandidate struct {
+	Path  string
+	Seed  int
+	Score float64
 }
 
-type StabilityRequestBody struct {
-	Steps       int                   `json:"steps"`
-	Width       int                   `json:"width"`
-	Height      int                   `json:"height"`
-	Seed        int                   `json:"seed"`
-	CFGScale    int                   `json:"cfg_scale"`
-	Samples     int                   `json:"samples"`
-	TextPrompts []StabilityTextPrompt `json:"text_prompts"`
-}
-
-type StabilityResponseArtifact struct {
-	Base64Image  string `json:"base64"`
-	FinishReason string `json:"finishReason"`
-	Seed         int    `json:"seed"`
-}
+type Story struct {
+	Id                uuid.UUID
+	Synopsis          StorySynopsis
+	Paragraphs        []string
+	Readability       []Readability
+	Moral             string
+	Character         CharacterSheet
+	IllustrationHints []string
+	RawGPTResponse    string
+	Pages             []Page
+	Title             string
+	CoverImagePath    string
+	CoverSeed         int
+	ArtStyle          ArtStyle
+	Outputs           map[string]string
+	Prompts           map[string]PromptVersion
+	// Versions of a prompt that came in after the one in Prompts, in the
+	// order they were first used
+	ChangedPrompts map[string][]PromptVersion
+	// The prompt versions the cover was drawn with
+	CoverPrompts map[string]PromptVersion
+	// Where the cover was uploaded for Slides, empty until it has been
+	CoverPublicImagePath string
+	// Manifests from before CoverPublicImagePath kept the upload here
+	CoverImage string
+	// Why the last run stopped, empty once it's gotten through
+	Failure string
+	// The title couldn't be thought of, and the story went on with the default
+	TitleFailed bool
+	// A Slides deck that was created but hasn't been filled in yet
+	PendingPresentationId string
+}
+
+const defaultTitle = "Storybook Story"
 
-type StabilityResponseBody struct {
-	Artifacts []StabilityResponseArtifact `json:"artifacts"`
-}
+var (
+	DEBUG                  bool
+	OPEN_AI_KEY            string
+	STABILITY_API_KEY      string
+	S3_BUCKET_NAME         string
+	AWS_ACCESS_KEY_ID      string
+	AWS_SECRET_ACCESS_KEY  string
+	AWS_REGION             string
+	FINAL_SLIDE_IMAGE      string
+	TEXT_PROVIDER          string
+	TEXT_MODEL             string
+	LOCAL_TEXT_URL         string
+	IMAGE_PROVIDER         string
+	STABILITY_ENGINE       string
+	LOCAL_IMAGE_URL        string
+	PUBLISHERS             string
+	EPUB_AUTHOR            string
+	EPUB_LANGUAGE          string
+	PROMPTS_DIR            string
+	IMAGE_NEGATIVE_PROMPTS []string
+	IMAGE_WEIGHTS          ImageWeights
+	IMAGE_SCORER           string
+	IMAGE_SCORER_URL       string
+	IMAGE_CANDIDATES       int
+	PAGE_WORKERS           int
+	TEXT_REQUESTS_PER_MIN  int
+	IMAGE_REQUESTS_PER_MIN int
+)
 
 var (
-	DEBUG                 bool
-	OPEN_AI_KEY           string
-	STABILITY_API_KEY     string
-	S3_BUCKET_NAME        string
-	AWS_ACCESS_KEY_ID     string
-	AWS_SECRET_ACCESS_KEY string
-	AWS_REGION            string
-	FINAL_SLIDE_IMAGE     string
+	textGenerator  TextGenerator
+	imageGenerator ImageGenerator
+	imageScorer    ImageScorer
+	publishers     []Publisher
 )
 
-func init() {
-	var err error
-
-	env.Load("./.env")
-	DEBUG = strings.ToLower(env.Get("DEBUG", "false")) == "true"
-	OPEN_AI_KEY, err = env.MustGet("OPEN_AI_KEY")
-	STABILITY_API_KEY, err = env.MustGet("STABILITY_API_KEY")
-	S3_BUCKET_NAME, err = env.MustGet("S3_BUCKET_NAME")
-	AWS_ACCESS_KEY_ID, err = env.MustGet("AWS_ACCESS_KEY_ID")
-	AWS_SECRET_ACCESS_KEY, err = env.MustGet("AWS_SECRET_ACCESS_KEY")
-	AWS_REGION, err = env.MustGet("AWS_REGION")
-	FINAL_SLIDE_IMAGE, err = env.MustGet("FINAL_SLIDE_IMAGE")
-	if err != nil {
-		panic(err)
+// The providers get set up on demand so commands that never generate
+// anything (like list) don't need any API keys. The fake ones never leave
+// the machine so there's nothing to be polite to.
+func setupProviders() {
+	setupPrompts()
+	textGenerator = getTextGenerator()
+	if TEXT_PROVIDER != "fake" && TEXT_REQUESTS_PER_MIN > 0 {
+		textGenerator = &RateLimitedTextGenerator{
+			Generator: textGenerator,
+			Limiter:   newTokenBucket(TEXT_REQUESTS_PER_MIN),
+		}
+	}
+	imageGenerator = getImageGenerator()
+	imageScorer = getImageScorer()
+	if IMAGE_PROVIDER != "placeholder" && IMAGE_REQUESTS_PER_MIN > 0 {
+		imageGenerator = &RateLimitedImageGenerator{
+			Generator: imageGenerator,
+			Limiter:   newTokenBucket(IMAGE_REQUESTS_PER_MIN),
+		}
 	}
 }
 
 func main() {
-	banner, _ := os.ReadFile("./banner.txt")
-	fmt.Println(string(banner))
-	story := buildStory()
-	collectSynopsisFromUser(story)
-	getStoryFromGPT(story)
-	extractParagraphs(story)
-	buildCovers(story)
+	// The first Ctrl-C cancels whatever is in flight and lets the stages save
+	// what they have, a second one quits on the spot.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	runCommand(ctx, os.Args[1:])
+}
+
+// Runs every stage the story hasn't finished yet. A fresh story goes through
+// all of them, a resumed one skips whatever the manifest says is done.
+//
+// This is the only place that decides what a failure means: flaky calls get
+// retried by runStage, a missing title is something we can live with, and
+// anything else stops the story (no new pages get started, but the ones
+// already underway get to finish) and comes back as a *StageError or
+// StageErrors.
+func runPipeline(ctx context.Context, story *Story) error {
+	ctx = withStory(ctx, story.Id)
+	story.Failure = ""
+	// Settled once so the pictures drawn later match the ones drawn first
+	if story.ArtStyle.Name == "" {
+		story.ArtStyle = getArtStyle(story.Synopsis.Style)
+	}
+	if story.RawGPTResponse == "" {
+		recordPrompts(story, "story", "story_structured")
+		err := runStage(ctx, "story", 0, func(ctx context.Context) error { return getStoryFromGPT(ctx, story) })
+		if err != nil {
+			return err
+		}
+		saveManifest(story)
+	}
+	if len(story.Paragraphs) == 0 {
+		_, run := startStage(ctx, "paragraphs", 0, "")
+		extractParagraphs(story)
+		if len(story.Paragraphs) == 0 {
+			err := &StageError{Stage: "story", Err: fmt.Errorf("the story came back empty")}
+			run.finish(err)
+			return err
+		}
+		run.finish(nil)
+		saveManifest(story)
+	}
+	// Once pages exist their paragraphs are set, so a story from before
+	// reading levels doesn't get rewritten out from under them
+	if len(story.Readability) != len(story.Paragraphs) && len(story.Pages) == 0 {
+		recordPrompts(story, "rewrite")
+		if len(story.Readability) > len(story.Paragraphs) {
+			story.Readability = nil
+		}
+		// Every paragraph is saved as soon as it's done, rewrites cost money
+		for index := len(story.Readability); index < len(story.Paragraphs); index++ {
+			err := runStage(ctx, "reading level", index+1, func(ctx context.Context) error { return checkReadingLevel(ctx, story, index) })
+			if err != nil {
+				return err
+			}
+			saveManifest(story)
+		}
+	}
+	if story.Character.isEmpty() {
+		recordPrompts(story, "character")
+		err := runStage(ctx, "character", 0, func(ctx context.Context) error {
+			sheet, err := getCharacterSheet(ctx, story)
+			if err != nil {
+				return err
+			}
+			story.Character = sheet
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		saveManifest(story)
+	}
+	err := buildCovers(ctx, story)
+	saveManifest(story)
+	if err != nil {
+		return err
+	}
 
 	count := len(story.Paragraphs)
-	story.Pages = make([]Page, count)
+	if len(story.Pages) != count {
+		story.Pages = make([]Page, count)
+	}
+	say("Sweet. I think this could use some creative touches. Give me a moment...")
+	progress.Event(ProgressEvent{Time: time.Now(), Story: story.Id.String(), Stage: "pages", Status: "started", Total: count})
+	drawing := false
+	for index := range story.Pages {
+		if pageIsComplete(&story.Pages[index]) {
+			emitSkipped(ctx, "page illustration", index+1)
+		} else {
+			drawing = true
+		}
+	}
+	if drawing {
+		// Anything published already has the old pictures in it
+		forgetOutputs(story)
+		recordPrompts(story, "page", "page_image", "character_image")
+	}
+	errs := StageErrors{}
+	for result := range buildPages(ctx, story) {
+		// Only this goroutine ever touches the story, the workers just hand
+		// back what they made
+		story.Pages[result.Index] = result.Page
+		saveManifest(story)
+		if result.Err != nil {
+			errs = append(errs, result.Err.(*StageError))
+		}
+	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Page < errs[j].Page })
+		return errs
+	}
+	err = publishStory(ctx, story)
+	if err != nil {
+		return err
+	}
+	say("\nWe've done it.")
+
+	return nil
+}
+
+type pageJob struct {
+	Index int
+	Page  Page
+}
+
+// Everything about the story a page needs, copied so the workers never have
+// to look at the story itself.
+type pageSettings struct {
+	StoryId        uuid.UUID
+	Synopsis       StorySynopsis
+	Character      CharacterSheet
+	ArtStyle       ArtStyle
+	CoverImagePath string
+}
+
+type pageResult struct {
+	Index int
+	Page  Page
+	Err   error
+}
+
+// A handful of workers take the pages in order, however long the story is.
+// Each one gets its own copy of the page and sends back the finished one
+// (or as far as it got) once it's done. Once a page fails nothing new gets
+// started, the story is stopping anyway and there's no point paying for the
+// rest of the pages.
+func buildPages(ctx context.Context, story *Story) <-chan pageResult {
+	jobs := make([]pageJob, 0, len(story.Pages))
+	for index, page := range story.Pages {
+		if !pageIsComplete(&story.Pages[index]) {
+			jobs = append(jobs, pageJob{Index: index, Page: page})
+		}
+	}
+	paragraphs := make([]string, len(story.Paragraphs))
+	copy(paragraphs, story.Paragraphs)
+	hints := make([]string, len(story.IllustrationHints))
+	copy(hints, story.IllustrationHints)
+	settings := pageSettings{
+		StoryId:        story.Id,
+		Synopsis:       story.Synopsis,
+		Character:      story.Character,
+		ArtStyle:       story.ArtStyle,
+		CoverImagePath: story.CoverImagePath,
+	}
+
+	queue := make(chan pageJob)
+	results := make(chan pageResult)
+	failed := make(chan struct{})
+	var failing sync.Once
+	go func() {
+		defer close(queue)
+		for _, job := range jobs {
+			select {
+			case queue <- job:
+			case <-failed:
+				return
+			}
+		}
+	}()
+	workers := PAGE_WORKERS
+	if workers < 1 {
+		workers = 1
+	}
 	var wg sync.WaitGroup
-	fmt.Println("Sweet. I think this could use some creative touches. Give me a moment...")
-	for i, _ := range story.Paragraphs {
+	for i := 0; i < workers; i++ {
 		wg.Add(1)
-		go constructPage(i, story, &wg)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				select {
+				case <-failed:
+					// Handed over just as another page failed
+					continue
+				default:
+				}
+				job.Page.Paragraph = paragraphs[job.Index]
+				if job.Index < len(hints) {
+					job.Page.IllustrationHint = hints[job.Index]
+				}
+				page, err := constructPage(ctx, settings, job.Index, job.Page)
+				if err != nil {
+					failing.Do(func() { close(failed) })
+				}
+				results <- pageResult{Index: job.Index, Page: page, Err: err}
+			}
+		}()
 	}
-	fmt.Println()
-	wg.Wait()
-	createSlideShow(story)
-	fmt.Println("\nWe've done it.")
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
 }
 
-func exclaimRandomly() {
+func forgetOutputs(story *Story) {
+	story.Outputs = make(map[string]string)
+}
+
+// One publisher falling over doesn't stop the rest from getting their turn.
+func publishStory(ctx context.Context, story *Story) error {
+	ctx = withStory(ctx, story.Id)
+	story.Failure = ""
+	errs := StageErrors{}
+	for _, publisher := range publishers {
+		if _, done := story.Outputs[publisher.Name()]; done {
+			continue
+		}
+		if ctx.Err() != nil {
+			errs = append(errs, &StageError{Stage: "publish", Err: fmt.Errorf("%s: %w", publisher.Name(), ctx.Err())})
+			continue
+		}
+		publisherCtx, run := startStage(ctx, "publish", 0, publisher.Name())
+		publisherCtx, cancel := context.WithTimeout(publisherCtx, stageTimeouts["publish"])
+		location, err := publisher.Publish(publisherCtx, story)
+		cancel()
+		if err != nil {
+			run.finish(err)
+			errs = append(errs, &StageError{Stage: "publish", Err: fmt.Errorf("%s: %w", publisher.Name(), err)})
+			continue
+		}
+		run.event.Output = location
+		run.finish(nil)
+		story.Outputs[publisher.Name()] = location
+		saveManifest(story)
+	}
+
+	return errs.orNil()
+}
+
+func getExclamation() string {
 	exclamations := []string{
 		"Oh yeah, this is looking good.",
 		"I like this a lot.",
@@ -144,188 +425,236 @@ func exclaimRandomly() {
 	}
 
 	index := rand.Intn(len(exclamations))
-	exclamation := exclamations[index]
-	fmt.Println(exclamation)
+
+	return exclamations[index]
 }
 
 func buildStory() *Story {
 	story := Story{
 		Id:         uuid.New(),
 		Paragraphs: make([]string, 0),
-		Title:      "Storybook Story",
-		CoverImage: FINAL_SLIDE_IMAGE,
+		Title:      defaultTitle,
+		Outputs:    make(map[string]string),
 	}
 
 	return &story
 }
 
+// Asks for whatever wasn't already filled in from the command line.
 func collectSynopsisFromUser(story *Story) {
-	// story.Synopsis.Animal = "zebra"
-	// story.Synopsis.Name = "poncho"
-	// story.Synopsis.Goal = "trying to become a giraffe"
-	// return
-
-	story.Synopsis = StorySynopsis{}
+	synopsis := &story.Synopsis
+	if synopsis.Animal != "" && synopsis.Name != "" && synopsis.Goal != "" {
+		return
+	}
 	reader := bufio.NewReader(os.Stdin)
 
 	fmt.Println("Hello! Welcome to story book. Let's write a story together.")
-	fmt.Println("Let's write a story about an animal.")
-	fmt.Println("What kind of Animal should we write about?")
-	fmt.Print("\n")
+	if synopsis.Animal == "" {
+		fmt.Println("Let's write a story about an animal.")
+		fmt.Println("What kind of Animal should we write about?")
+		fmt.Print("\n")
+
+		rawAnimal, _ := reader.ReadString('\n')
+		synopsis.Animal = strings.TrimSpace(rawAnimal)
 
-	rawAnimal, _ := reader.ReadString('\n')
-	animal := strings.TrimSpace(rawAnimal)
+		fmt.Printf("\nAh! %s! That's perfect!\n", synopsis.Animal)
+	}
 
-	fmt.Printf("\nAh! %s! That's perfect!\n", animal)
-	fmt.Printf("And what should we name this %s?\n\n", animal)
+	if synopsis.Name == "" {
+		fmt.Printf("And what should we name this %s?\n\n", synopsis.Animal)
 
-	rawName, _ := reader.ReadString('\n')
-	name := strings.TrimSpace(rawName)
+		rawName, _ := reader.ReadString('\n')
+		synopsis.Name = strings.TrimSpace(rawName)
 
-	fmt.Printf("\nA %s named %s. Interesting.\n", animal, name)
-	fmt.Printf("What are %s's aspirations? Finish the sentence:\n", name)
-	fmt.Printf("\"%s is trying to...\"\n\n", name)
+		fmt.Printf("\nA %s named %s. Interesting.\n", synopsis.Animal, synopsis.Name)
+	}
 
-	rawGoal, _ := reader.ReadString('\n')
-	goal := strings.TrimSpace(rawGoal)
+	if synopsis.Goal == "" {
+		fmt.Printf("What are %s's aspirations? Finish the sentence:\n", synopsis.Name)
+		fmt.Printf("\"%s is trying to...\"\n\n", synopsis.Name)
 
-	fmt.Printf("\nOkay. %s is trying to %s.\n\n", name, goal)
+		rawGoal, _ := reader.ReadString('\n')
+		synopsis.Goal = strings.TrimSpace(rawGoal)
+	}
 
-	story.Synopsis.Animal = animal
-	story.Synopsis.Name = name
-	story.Synopsis.Goal = goal
+	fmt.Printf("\nOkay. %s is trying to %s.\n\n", synopsis.Name, synopsis.Goal)
 }
 
-func buildCovers(story *Story) {
+func buildCovers(ctx context.Context, story *Story) error {
 	var wg sync.WaitGroup
-	wg.Add(2)
-	go getTitle(story, &wg)
-	go getCoverImage(story, &wg)
+	var title, coverImagePath string
+	var coverSeed int
+	var titleErr, coverErr error
+	if story.Title == defaultTitle && !story.TitleFailed {
+		recordPrompts(story, "title")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			titleErr = runStage(ctx, "title", 0, func(ctx context.Context) error {
+				var err error
+				title, err = getTitle(ctx, story)
+				return err
+			})
+		}()
+	}
+	if !fileExists(story.CoverImagePath) {
+		recordPrompts(story, "cover", "cover_image", "character_image")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			filtered := 0
+			coverErr = runStage(ctx, "cover", 0, func(ctx context.Context) error {
+				var err error
+				coverImagePath, coverSeed, err = getCoverImage(ctx, story, filtered)
+				if errors.Is(err, ErrImageFiltered) {
+					filtered++
+				}
+				return err
+			})
+		}()
+	}
 	wg.Wait()
-	fmt.Println("I think I've thought of a pretty good title")
+	if title != "" {
+		story.Title = title
+	}
+	if coverImagePath != "" {
+		story.CoverImagePath = coverImagePath
+		story.CoverSeed = coverSeed
+		story.CoverPrompts = notePrompts(nil, "cover", "cover_image", "character_image")
+		story.CoverPublicImagePath = ""
+		forgetOutputs(story)
+	}
+	if titleErr != nil && ctx.Err() == nil {
+		// A story with a boring title is still a story
+		story.TitleFailed = true
+		say(fmt.Sprintf("I can't think of a good title, so %q it is.", story.Title))
+	} else {
+		say("I think I've thought of a pretty good title")
+	}
+
+	return coverErr
 }
 
-func getTitle(story *Story, wg *sync.WaitGroup) {
-	template := `Give me a potential title for the following short story about %s,
-	a %s who is trying to %s.
-	Do not give me a title with a subtitle. Format your response the following way:
-	TITLE: "[title goes here]"
-	"%s"`
-	prompt := fmt.Sprintf(
-		template,
-		story.Synopsis.Name,
-		story.Synopsis.Animal,
-		story.Synopsis.Goal,
-		story.RawGPTResponse,
-	)
-	resp, err := getGPTResponse(prompt)
+func getTitle(ctx context.Context, story *Story) (string, error) {
+	data := getPromptData(story.Synopsis)
+	data.Story = story.RawGPTResponse
+	prompt, err := renderPrompt("title", data)
 	if err != nil {
-		if DEBUG {
-			panic(err)
-		}
-		fmt.Println("Screw it. I can't think of a title. No point in writing a story without a title")
-		os.Exit(1)
-	}
-	properlyFormatted, err := regexp.MatchString(`^title: ".*"$`, strings.ToLower(strings.TrimSpace(resp)))
-	if err != nil || !properlyFormatted {
-		if DEBUG {
-			fmt.Printf("properlyFormatted: %t\nresp: %s", properlyFormatted, resp)
-			panic(err)
-		}
-		fmt.Println("Eh. I've got a foggy brain right now. I can't work like this. Goodbye.")
-		os.Exit(1)
+		return "", err
+	}
+	resp, err := getGPTResponse(ctx, prompt)
+	if err != nil {
+		return "", err
 	}
-	story.Title = strings.TrimSpace(strings.Split(resp, `"`)[1])
-	wg.Done()
+	properlyFormatted, _ := regexp.MatchString(`^title: ".*"$`, strings.ToLower(strings.TrimSpace(resp)))
+	if !properlyFormatted {
+		return "", fmt.Errorf("%w, got %q", ErrTitleFormat, resp)
+	}
+
+	return strings.TrimSpace(strings.Split(resp, `"`)[1]), nil
 }
 
-func getCoverImage(story *Story, wg *sync.WaitGroup) {
-	template := `briefly describe a potential idea for the cover a childrens book about a %s named %s who is trying to %s`
-	prompt := fmt.Sprintf(
-		template,
-		story.Synopsis.Animal,
-		story.Synopsis.Name,
-		story.Synopsis.Goal,
-	)
-	coverBaseDescription, err := getGPTResponse(prompt)
+// filtered is how many times the cover has come back filtered already, so
+// a story with a seed doesn't ask for the same picture again.
+func getCoverImage(ctx context.Context, story *Story, filtered int) (string, int, error) {
+	data := getPromptData(story.Synopsis)
+	data.Style = story.ArtStyle.Prompt
+	data.Character = story.Character.Description
+	prompt, err := renderPrompt("cover", data)
 	if err != nil {
-		if DEBUG {
-			panic(err)
-		}
-		fmt.Println("I can't picture this anymore. Forget about it.")
-		os.Exit(1)
+		return "", 0, err
 	}
-	coverDescription := fmt.Sprintf("in the style of a watercolor childrens book. %s", coverBaseDescription)
-	results, err := getStabilityImages([]StabilityTextPrompt{
-		{Text: coverDescription, Weight: 1},
-		{Text: "writing words letters alphabet text", Weight: -1},
-	})
+	data.Description, err = getGPTResponse(ctx, prompt)
 	if err != nil {
-		if DEBUG {
-			panic(err)
-		}
-		fmt.Println("I messed up making the cover. It's worthless now.")
-		os.Exit(1)
+		return "", 0, err
+	}
+	coverDescription, err := renderPrompt("cover_image", data)
+	if err != nil {
+		return "", 0, err
+	}
+	imagePrompts, err := getImagePrompts(coverDescription, story.Synopsis, story.Character, story.ArtStyle)
+	if err != nil {
+		return "", 0, err
+	}
+	request := ImageRequest{
+		Prompts:     imagePrompts,
+		Seed:        getSeed(story.Synopsis, story.CoverSeed),
+		StylePreset: story.ArtStyle.StylePreset,
+	}
+	if request.Seed != 0 {
+		request.Seed += filtered
+	}
+	results, err := generateImages(ctx, request)
+	if err != nil {
+		return "", 0, err
 	}
 
-	// Should only ever really be 1 here
-	for _, result := range results.Artifacts {
+	if len(results) == 0 {
+		return "", 0, fmt.Errorf("no cover came back")
+	}
+	// Should only ever really be 1 here, the first one that wasn't filtered
+	// is the cover
+	filteredReasons := make([]string, 0)
+	for _, result := range results {
+		if result.FinishReason == "CONTENT_FILTERED" || result.FinishReason == "ERROR" {
+			filteredReasons = append(filteredReasons, result.FinishReason)
+			continue
+		}
 		os.MkdirAll(fmt.Sprintf("./images/%s", story.Id), os.ModePerm)
 		filePath := fmt.Sprintf("./images/%s/cover.png", story.Id)
-		imageBytes, _ := base64.StdEncoding.DecodeString(result.Base64Image)
-		f, _ := os.Create(filePath)
-		f.Write(imageBytes)
-		f.Close()
-		f, _ = os.Open(filePath)
-		uploader := getUploader()
-		upload, err := uploader.Upload(&s3manager.UploadInput{
-			Bucket: aws.String(S3_BUCKET_NAME),
-			Key:    aws.String(fmt.Sprintf("DOCTOR_SLIDES_%s_cover.png", story.Id)),
-			Body:   f,
-		})
+		err = os.WriteFile(filePath, result.Bytes, 0644)
 		if err != nil {
-			if DEBUG {
-				panic(err)
-			}
-			fmt.Println("You know, I am having trouble posting these images. Hrm. Try again later?")
-			os.Exit(1)
+			return "", 0, err
 		}
-		story.CoverImage = upload.Location
+		return filePath, result.Seed, nil
 	}
 
-	wg.Done()
+	return "", 0, fmt.Errorf("%w: the cover came back %s", ErrImageFiltered, strings.Join(filteredReasons, ", "))
 }
 
-func getStoryFromGPT(story *Story) {
+// The story's seed if it has one, otherwise whatever the picture was drawn
+// with last time so drawing it again comes out the same.
+func getSeed(synopsis StorySynopsis, previous int) int {
+	if synopsis.Seed != 0 {
+		return synopsis.Seed
+	}
+
+	return previous
+}
+
+func getStoryFromGPT(ctx context.Context, story *Story) error {
 	// b, _ := os.ReadFile("./example.txt")
 	// story.RawGPTResponse = string(b)
 	// return
-	fmt.Println("Let me think about how this story will go...")
-	template := `Write me a short story in the style of a children's book about a
-	%s named %s. %s is trying to %s. There should be a rising action, a climax,
-	falling action, and a resolution. The story does not need to have a happy
-	ending.`
-	prompt := fmt.Sprintf(
-		template,
-		story.Synopsis.Animal,
-		story.Synopsis.Name,
-		story.Synopsis.Name,
-		story.Synopsis.Goal,
-	)
-	resp, err := getGPTResponse(prompt)
+	say("Let me think about how this story will go...")
+	draft, resp, err := getStoryDraft(ctx, story.Synopsis)
+	if err == nil {
+		story.RawGPTResponse = resp
+		applyStoryDraft(story, draft)
+		say("Okay. I think I have an idea.")
+		return nil
+	}
+	if !errors.Is(err, ErrStructuredUnsupported) {
+		return err
+	}
+
+	// Otherwise it's one big block of text to split up into pages ourselves
+	prompt, err := renderPrompt("story", getPromptData(story.Synopsis))
 	if err != nil {
-		if DEBUG {
-			panic(err)
-		}
-		fmt.Println("Hrm. I actually can't think of a story like that. Try again later!")
-		os.Exit(1)
+		return err
+	}
+	resp, err = getGPTResponse(ctx, prompt)
+	if err != nil {
+		return err
 	}
 	story.RawGPTResponse = resp
-	fmt.Println("Okay. I think I have an idea.")
+	say("Okay. I think I have an idea.")
+
+	return nil
 }
 
 func extractParagraphs(story *Story) {
-	fmt.Println("Let me edit it real quick...")
+	say("Let me edit it real quick...")
 	lines := strings.Split(story.RawGPTResponse, "\n")
 	for _, line := range lines {
 		trimmed := strings.TrimSpace(line)
@@ -335,889 +664,295 @@ func extractParagraphs(story *Story) {
 	}
 }
 
-func constructPage(index int, story *Story, wg *sync.WaitGroup) {
-	// We do a brief sleep in some of these so that we don't murder the API
-	waitTime := rand.Intn(10) + 2
-	time.Sleep(time.Duration(waitTime) * time.Second)
+// Works on its own copy of the page and never touches the story, so any
+// number of these can run at once.
+func constructPage(ctx context.Context, settings pageSettings, index int, page Page) (Page, error) {
+	if page.Id == uuid.Nil {
+		page.Id = uuid.New()
+	}
 
-	newPage := Page{}
-	newPage.Paragraph = story.Paragraphs[index]
-	newPage.Id = uuid.New()
-	story.Pages[index] = newPage
+	if page.ImageDescriptor == "" {
+		err := runStage(ctx, "page description", index+1, func(ctx context.Context) error {
+			return buildPageDescriptors(ctx, settings, &page)
+		})
+		if err != nil {
+			return page, err
+		}
+	}
+	if !fileExists(page.ImagePath) {
+		err := runStage(ctx, "page illustration", index+1, func(ctx context.Context) error { return getPageIllustration(ctx, settings, index, &page) })
+		if err != nil {
+			return page, err
+		}
+	}
+
+	return page, nil
+}
 
-	buildPageDescriptors(index, story)
-	getPageIllustration(index, story)
-	uploadPublicImage(index, story)
-	exclaimRandomly()
+func getGPTResponse(ctx context.Context, message string) (string, error) {
+	var resp string
+	err := apiRetryPolicy.Do(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = textGenerator.Generate(ctx, message)
+		return err
+	})
 
-	wg.Done()
+	return resp, err
 }
 
-func getGPTResponse(message string) (string, error) {
-	client := openai.NewClient(OPEN_AI_KEY)
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: openai.GPT3Dot5Turbo,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: message,
-				},
-			},
-		},
-	)
+func buildPageDescriptors(ctx context.Context, settings pageSettings, newPage *Page) error {
+	synopsis := settings.Synopsis
+	data := getPromptData(synopsis)
+	data.Style = settings.ArtStyle.Prompt
+	data.Character = settings.Character.Description
+	data.Excerpt = newPage.Paragraph
+	data.Hint = newPage.IllustrationHint
+	excerptDescriptor, err := renderPrompt("page", data)
 	if err != nil {
-		return "", err
+		return err
 	}
-	return resp.Choices[0].Message.Content, nil
-}
-func buildPageDescriptors(index int, story *Story) {
-	// return
-	newPage := &story.Pages[index]
-	excerptDescriptorTemplate := `
-	The following is an excerpt from a childrens story about a(n) %s named
-	%s who is trying to %s. Do not refer to %s by name. Given this excerpt write a brief
-	(two sentence max) description of an illustration that would go well with
-	this text.
-
-	"%s"`
-	newPage.ExcerptDescriptor = fmt.Sprintf(
-		excerptDescriptorTemplate,
-		story.Synopsis.Animal,
-		story.Synopsis.Name,
-		story.Synopsis.Goal,
-		story.Synopsis.Name,
-		newPage.Paragraph,
-	)
-	imageDescriptor, err := getGPTResponse(newPage.ExcerptDescriptor)
+	newPage.ExcerptDescriptor = excerptDescriptor
+	data.Description, err = getGPTResponse(ctx, newPage.ExcerptDescriptor)
 	if err != nil {
-		if DEBUG {
-			panic(err)
-		}
-		fmt.Println("I'm actually having a hard time picturing this. Let's try again later")
-		os.Exit(1)
+		return err
+	}
+	imageDescriptor, err := renderPrompt("page_image", data)
+	if err != nil {
+		return err
 	}
-	imageDescriptor = fmt.Sprintf("%s as a watercolor done in the style of a childrens book", imageDescriptor)
 	imageDescriptor = strings.ToLower(imageDescriptor)
-	imageDescriptor = strings.ReplaceAll(
-		imageDescriptor,
-		story.Synopsis.Name,
-		fmt.Sprintf("the %s", story.Synopsis.Animal),
-	)
+	// The image provider doesn't know who Poncho is, but it knows zebras
+	if name := strings.ToLower(strings.TrimSpace(synopsis.Name)); name != "" {
+		imageDescriptor = strings.ReplaceAll(
+			imageDescriptor,
+			name,
+			fmt.Sprintf("the %s", synopsis.Animal),
+		)
+	}
 	newPage.ImageDescriptor = imageDescriptor
+	newPage.Prompts = notePrompts(newPage.Prompts, "page", "page_image")
+
+	return nil
 }
 
-func getStabilityImages(prompts []StabilityTextPrompt) (*StabilityResponseBody, error) {
-	postUrl := "https://api.stability.ai/v1/generation/stable-diffusion-xl-1024-v1-0/text-to-image"
-	bodyData := StabilityRequestBody{
-		Steps:       40,
-		Width:       1344,
-		Height:      768,
-		Seed:        0,
-		CFGScale:    10,
-		Samples:     1,
-		TextPrompts: prompts,
-	}
-	postBody, _ := json.Marshal(bodyData)
-	r, _ := http.NewRequest("POST", postUrl, bytes.NewBuffer(postBody))
-	r.Header.Add("content-type", "application/json")
-	r.Header.Add("Accept", "application/json")
-	r.Header.Add("Stability-Client-ID", "storybook")
-	r.Header.Add("Authorization", fmt.Sprintf("Bearer %s", STABILITY_API_KEY))
-	client := &http.Client{}
-	res, err := client.Do(r)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		if DEBUG {
-			b, _ := io.ReadAll(res.Body)
-			fmt.Println(res.StatusCode)
-			fmt.Println(string(b))
-			panic("Non-200 from Stability")
+// Fills in the size and sample count every picture in the book shares, and
+// drops any prompts that came out empty.
+func generateImages(ctx context.Context, request ImageRequest) ([]GeneratedImage, error) {
+	prompts := make([]ImagePrompt, 0, len(request.Prompts))
+	for _, prompt := range request.Prompts {
+		if strings.TrimSpace(prompt.Text) != "" {
+			prompts = append(prompts, prompt)
 		}
-		fmt.Println("I messed this painting up. Sorry.")
-		os.Exit(1)
 	}
-	results := &StabilityResponseBody{}
-	err = json.NewDecoder(res.Body).Decode(results)
-	if err != nil {
-		return nil, err
+	request.Prompts = prompts
+	request.Width = 1344
+	request.Height = 768
+	if request.Samples == 0 {
+		request.Samples = 1
+	}
+	var images []GeneratedImage
+	err := apiRetryPolicy.Do(ctx, func(ctx context.Context) error {
+		var err error
+		images, err = imageGenerator.GenerateImages(ctx, request)
+		return err
+	})
+	if err == nil {
+		recordUsage(ctx, 0, len(images))
 	}
 
-	return results, nil
+	return images, err
 }
 
-func getPageIllustration(index int, story *Story) {
+func getPageIllustration(ctx context.Context, settings pageSettings, index int, newPage *Page) error {
 	// story.Pages[index].ImagePath = fmt.Sprintf("./images/f672b210-047a-482a-8237-a0078a0cbb09/%d.png", index)
 	// return
-	newPage := &story.Pages[index]
 
-	results, err := getStabilityImages([]StabilityTextPrompt{
-		{Text: newPage.ImageDescriptor, Weight: 1},
-	})
+	imagePrompts, err := getImagePrompts(newPage.ImageDescriptor, settings.Synopsis, settings.Character, settings.ArtStyle)
 	if err != nil {
-		if DEBUG {
-			panic(err)
+		return err
+	}
+	newPage.ImagePrompts = imagePrompts
+	request := ImageRequest{
+		Prompts:     imagePrompts,
+		Samples:     IMAGE_CANDIDATES,
+		Seed:        getSeed(settings.Synopsis, newPage.Seed),
+		StylePreset: settings.ArtStyle.StylePreset,
+	}
+	if request.Seed != 0 {
+		// Past every seed the samples before used
+		request.Seed += newPage.filtered * request.Samples
+	}
+	if settings.Synopsis.FromCover > 0 {
+		// Without a cover there's nothing to start from, so it's drawn from scratch
+		cover, err := os.ReadFile(settings.CoverImagePath)
+		if err == nil {
+			request.InitImage = cover
+			request.InitImageStrength = settings.Synopsis.FromCover
 		}
-		fmt.Println("This art didn't turn out the way I wanted. Maybe we should try again later.")
-		os.Exit(1)
-	}
-
-	for _, result := range results.Artifacts {
-		os.MkdirAll(fmt.Sprintf("./images/%s", story.Id), os.ModePerm)
-		filePath := fmt.Sprintf("./images/%s/%d.png", story.Id, index)
-		imageBytes, _ := base64.StdEncoding.DecodeString(result.Base64Image)
-		f, _ := os.Create(filePath)
-		f.Write(imageBytes)
-		newPage.ImagePath = filePath
 	}
-}
-
-func uploadPublicImage(index int, story *Story) {
-	page := &story.Pages[index]
-	uploader := getUploader()
-	f, err := os.Open(page.ImagePath)
+	results, err := generateImages(ctx, request)
 	if err != nil {
-		if DEBUG {
-			panic(err)
+		return err
+	}
+
+	// Every candidate is kept so a different one can be picked later
+	candidates := make([]ImageCandidate, 0, len(results))
+	filtered := make([]string, 0)
+	scoring := len(results) > 1
+	os.MkdirAll(fmt.Sprintf("./images/%s", settings.StoryId), os.ModePerm)
+	for _, result := range results {
+		if result.FinishReason == "CONTENT_FILTERED" || result.FinishReason == "ERROR" {
+			filtered = append(filtered, result.FinishReason)
+			continue
 		}
-		fmt.Println("Crap. I misplaced my art. Try again later?")
-		os.Exit(1)
-	}
-	upload, err := uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(S3_BUCKET_NAME),
-		Key:    aws.String(fmt.Sprintf("DOCTOR_SLIDES_%s_%d.png", story.Id, index)),
-		Body:   f,
-	})
-	if err != nil {
-		if DEBUG {
-			panic(err)
+		candidate := ImageCandidate{
+			Path: fmt.Sprintf("./images/%s/%d-%d.png", settings.StoryId, index+1, len(candidates)+1),
+			Seed: result.Seed,
+		}
+		err = os.WriteFile(candidate.Path, result.Bytes, 0644)
+		if err != nil {
+			return err
+		}
+		if scoring {
+			candidate.Score, err = imageScorer.ScoreImage(ctx, newPage.ImageDescriptor, result.Bytes)
+			if err != nil {
+				// The pictures are already paid for, so they're not thrown out over it
+				tell(fmt.Sprintf("I couldn't score the pictures for page %d, so I'm keeping the first one.", index+1))
+				for candidateIndex := range candidates {
+					candidates[candidateIndex].Score = 0
+				}
+				candidate.Score = 0
+				scoring = false
+			}
 		}
-		fmt.Println("You know, I am having trouble posting these images. Hrm. Try again later?")
-		os.Exit(1)
+		candidates = append(candidates, candidate)
 	}
-	page.PublicImagePath = upload.Location
-}
-
-func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
-	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("Go to the following link in your browser then type the "+
-		"authorization code: \n%v\n", authURL)
-
-	var authCode string
-	if _, err := fmt.Scan(&authCode); err != nil {
-		fmt.Println("Unable to read authorization code")
+	if len(candidates) == 0 {
+		newPage.filtered++
+		return fmt.Errorf("%w: every picture came back %s", ErrImageFiltered, strings.Join(filtered, ", "))
 	}
 
-	tok, err := config.Exchange(oauth2.NoContext, authCode)
-	if err != nil {
-		fmt.Println("Unable to retrieve token from web")
+	selected := 0
+	for candidateIndex, candidate := range candidates {
+		if candidate.Score > candidates[selected].Score {
+			selected = candidateIndex
+		}
 	}
+	newPage.Candidates = candidates
+	newPage.Prompts = notePrompts(newPage.Prompts, "character_image")
+	// Even drawn to the same file it's a different picture now
+	newPage.PublicImagePath = ""
+	selectCandidate(newPage, selected)
 
-	return tok
+	return nil
 }
 
-func tokenFromFile(file string) (*oauth2.Token, error) {
-	f, err := os.Open(file)
-	defer f.Close()
-	if err != nil {
-		return nil, err
+// Makes one of the page's candidates the picture that goes in the book. It
+// has to be uploaded again if it changed.
+func selectCandidate(page *Page, selected int) {
+	candidate := page.Candidates[selected]
+	if page.ImagePath != candidate.Path {
+		page.PublicImagePath = ""
 	}
-	tok := &oauth2.Token{}
-	err = json.NewDecoder(f).Decode(tok)
-
-	return tok, err
+	page.Selected = selected
+	page.ImagePath = candidate.Path
+	page.Seed = candidate.Seed
 }
 
-func saveToken(path string, token *oauth2.Token) {
-	fmt.Printf("Saving credential file to: %s\n", path)
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	defer f.Close()
-	if err != nil {
-		fmt.Println("Unable to cache OAuth token")
+// Hands back the first upload that didn't make it, if any. The ones that did
+// are kept on the story so they aren't uploaded again next time. The uploads
+// only report where things ended up, the story is filled in once they're
+// all back.
+func uploadPublicImages(ctx context.Context, story *Story) error {
+	var wg sync.WaitGroup
+	locations := make([]string, len(story.Pages)+1)
+	errs := make([]error, len(story.Pages)+1)
+	if story.CoverImagePath != "" && story.CoverPublicImagePath == "" {
+		wg.Add(1)
+		go func(key string, filePath string) {
+			defer wg.Done()
+			errs[0] = runStage(ctx, "upload", 0, func(ctx context.Context) error {
+				var err error
+				locations[0], err = uploadFile(ctx, filePath, key)
+				return err
+			})
+		}(fmt.Sprintf("DOCTOR_SLIDES_%s_cover.png", story.Id), story.CoverImagePath)
+	}
+	for i, page := range story.Pages {
+		if page.PublicImagePath != "" {
+			continue
+		}
+		wg.Add(1)
+		go func(index int, key string, filePath string) {
+			defer wg.Done()
+			errs[index+1] = runStage(ctx, "upload", index+1, func(ctx context.Context) error {
+				var err error
+				locations[index+1], err = uploadFile(ctx, filePath, key)
+				return err
+			})
+		}(i, fmt.Sprintf("DOCTOR_SLIDES_%s_%d.png", story.Id, i), page.ImagePath)
 	}
-	json.NewEncoder(f).Encode(token)
-}
+	wg.Wait()
 
-func getGoogleClient() *http.Client {
-	credsBytes, err := os.ReadFile("./credentials.json")
-	if err != nil {
-		panic(err)
+	if locations[0] != "" {
+		story.CoverPublicImagePath = locations[0]
 	}
-	config, err := google.ConfigFromJSON(credsBytes, "https://www.googleapis.com/auth/documents", "https://www.googleapis.com/auth/presentations", "https://www.googleapis.com/auth/spreadsheets")
-	if err != nil {
-		panic(err)
+	for index := range story.Pages {
+		if locations[index+1] != "" {
+			story.Pages[index].PublicImagePath = locations[index+1]
+		}
 	}
-	tokFile := "token.json"
-	tok, err := tokenFromFile(tokFile)
-	if err != nil {
-		tok = getTokenFromWeb(config)
-		saveToken(tokFile, tok)
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
 	}
-	return config.Client(context.Background(), tok)
-}
-
-func getUploader() *s3manager.Uploader {
-	sess := session.Must(session.NewSession())
-	uploader := s3manager.NewUploader(sess)
 
-	return uploader
+	return nil
 }
 
-func createSlideShow(story *Story) {
-	fmt.Println("Ah! That's perfect! Let me just put the finishing touches on it...")
-	ctx := context.Background()
-	client := getGoogleClient()
-	slidesService, _ := slides.NewService(ctx, option.WithHTTPClient(client))
-
-	presentation := &slides.Presentation{}
-	presentation.Title = story.Title
-	presentation.Layouts = []*slides.Page{
-		{
-			PageType: "LAYOUT",
-		},
-	}
-	presentation, _ = slidesService.Presentations.Create(presentation).Do()
-	updates := slides.BatchUpdatePresentationRequest{}
-	updates.Requests = make([]*slides.Request, 0)
-	updates.Requests = append(updates.Requests, buildTitleSlideUpdates(story)...)
-	for index, page := range story.Pages {
-		updates.Requests = append(updates.Requests, buildPageSlideUpdates(index, &page)...)
-	}
-	updates.Requests = append(updates.Requests, getFinalSlide()...)
-
-	_, err := slidesService.Presentations.BatchUpdate(presentation.PresentationId, &updates).Do()
+func uploadFile(ctx context.Context, filePath string, key string) (string, error) {
+	uploader, err := getUploader()
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-}
+	location := ""
+	err = apiRetryPolicy.Do(ctx, func(ctx context.Context) error {
+		// Opened fresh every time since a failed upload leaves it half read
+		f, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		upload, err := uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+			Bucket: aws.String(S3_BUCKET_NAME),
+			Key:    aws.String(key),
+			Body:   f,
+		})
+		if err != nil {
+			return err
+		}
+		location = upload.Location
+		return nil
+	})
 
-func buildTitleSlideUpdates(story *Story) []*slides.Request {
-	// ctx := context.Background()
-	// client := getGoogleClient()
-	// slidesService, _ := slides.NewService(ctx, option.WithHTTPClient(client))
-
-	// presentation := &slides.Presentation{}
-	// presentation.Title = "Storybook Final Slide test"
-	// presentation.Layouts = []*slides.Page{
-	// 	{
-	// 		PageType: "LAYOUT",
-	// 	},
-	// }
-	// presentation, _ = slidesService.Presentations.Create(presentation).Do()
-	updates := slides.BatchUpdatePresentationRequest{}
-	updates.Requests = []*slides.Request{
-		{
-			CreateSlide: &slides.CreateSlideRequest{
-				ObjectId: "titleSlide",
-				SlideLayoutReference: &slides.LayoutReference{
-					PredefinedLayout: "BLANK",
-				},
-			},
-		},
-		{
-			DeleteObject: &slides.DeleteObjectRequest{
-				ObjectId: "p", // this is the title given to the default slide
-			},
-		},
-		{
-			CreateImage: &slides.CreateImageRequest{
-				ObjectId: "titlecoverimage",
-				Url:      story.CoverImage,
-				ElementProperties: &slides.PageElementProperties{
-					PageObjectId: "titleSlide",
-					Transform: &slides.AffineTransform{
-						ScaleX:     1.05,
-						ScaleY:     1.05,
-						TranslateX: 0.0,
-						TranslateY: 0.0,
-						Unit:       "PT",
-					},
-				},
-			},
-		},
-		{
-			CreateShape: &slides.CreateShapeRequest{
-				ObjectId:  "titlebackground",
-				ShapeType: "TEXT_BOX",
-				ElementProperties: &slides.PageElementProperties{
-					PageObjectId: "titleSlide",
-					Size: &slides.Size{
-						Width:  &slides.Dimension{Magnitude: 720, Unit: "PT"},
-						Height: &slides.Dimension{Magnitude: 405.64, Unit: "PT"},
-					},
-					// Transform: &slides.AffineTransform{
-					// 	ScaleX:     1.0,
-					// 	ScaleY:     1.0,
-					// 	TranslateX: 15.0,
-					// 	TranslateY: 15.0,
-					// 	Unit:       "PT",
-					// },
-				},
-			},
-		},
-		{
-			UpdateShapeProperties: &slides.UpdateShapePropertiesRequest{
-				ObjectId: "titlebackground",
-				Fields:   "shapeBackgroundFill,outline,contentAlignment",
-				ShapeProperties: &slides.ShapeProperties{
-					ContentAlignment: "Middle",
-					// Outline: &slides.Outline{
-					// 	Weight:    &slides.Dimension{Magnitude: 1, Unit: "PT"},
-					// 	DashStyle: "SOLID",
-					// 	OutlineFill: &slides.OutlineFill{
-					// 		SolidFill: &slides.SolidFill{
-					// 			Color: &slides.OpaqueColor{
-					// 				RgbColor: &slides.RgbColor{
-					// 					Red:   0.35,
-					// 					Green: 0.35,
-					// 					Blue:  0.35,
-					// 				},
-					// 			},
-					// 		},
-					// 	},
-					// },
-					ShapeBackgroundFill: &slides.ShapeBackgroundFill{
-						SolidFill: &slides.SolidFill{
-							Alpha: 0.5,
-							Color: &slides.OpaqueColor{
-								RgbColor: &slides.RgbColor{
-									Red:   0.37,
-									Green: 0.37,
-									Blue:  0.37,
-								},
-							},
-						},
-					},
-				},
-			},
-		},
-		{
-			InsertText: &slides.InsertTextRequest{
-				ObjectId: "titlebackground",
-				Text:     story.Title,
-			},
-		},
-		{
-			UpdateParagraphStyle: &slides.UpdateParagraphStyleRequest{
-				ObjectId: "titlebackground",
-				Fields:   "alignment",
-				Style: &slides.ParagraphStyle{
-					Alignment: "Center",
-				},
-			},
-		},
-		{
-			UpdateTextStyle: &slides.UpdateTextStyleRequest{
-				ObjectId: "titlebackground",
-				Fields:   "bold,fontSize,foregroundColor,fontFamily",
-				Style: &slides.TextStyle{
-					Bold:       true,
-					FontSize:   &slides.Dimension{Magnitude: 80, Unit: "PT"},
-					FontFamily: "Pacifico",
-					ForegroundColor: &slides.OptionalColor{
-						OpaqueColor: &slides.OpaqueColor{
-							RgbColor: &slides.RgbColor{
-								Red:   1.0,
-								Green: 1.0,
-								Blue:  1.0,
-							},
-						},
-					},
-				},
-			},
-		},
-	}
-
-	// _, err := slidesService.Presentations.BatchUpdate(presentation.PresentationId, &updates).Do()
-	// if err != nil {
-	// 	panic(err)
-	// }
-
-	return updates.Requests
+	return location, err
 }
 
-func buildPageSlideUpdates(index int, page *Page) []*slides.Request {
-	slideId := fmt.Sprintf("%d_SLIDE", index)
-	paragraphId := fmt.Sprintf("%d_PARAGRAPH", index)
-	imageId := fmt.Sprintf("%d_IMAGE", index)
-
-	return []*slides.Request{
-		{
-			CreateSlide: &slides.CreateSlideRequest{
-				ObjectId: slideId,
-				SlideLayoutReference: &slides.LayoutReference{
-					PredefinedLayout: "BLANK",
-				},
-			},
-		},
-		{
-			CreateImage: &slides.CreateImageRequest{
-				ObjectId: imageId,
-				Url:      page.PublicImagePath,
-				ElementProperties: &slides.PageElementProperties{
-					PageObjectId: slideId,
-					Transform: &slides.AffineTransform{
-						ScaleX:     1.05,
-						ScaleY:     1.05,
-						TranslateX: 0.0,
-						TranslateY: 0.0,
-						Unit:       "PT",
-					},
-				},
-			},
-		},
-		{
-			CreateShape: &slides.CreateShapeRequest{
-				ObjectId:  paragraphId,
-				ShapeType: "TEXT_BOX",
-				ElementProperties: &slides.PageElementProperties{
-					PageObjectId: slideId,
-					Size: &slides.Size{
-						Width:  &slides.Dimension{Magnitude: 269, Unit: "PT"},
-						Height: &slides.Dimension{Magnitude: 360, Unit: "PT"},
-					},
-					Transform: &slides.AffineTransform{
-						ScaleX:     1.0,
-						ScaleY:     1.0,
-						TranslateX: 15.0,
-						TranslateY: 15.0,
-						Unit:       "PT",
-					},
-				},
-			},
-		},
-		{
-			UpdateShapeProperties: &slides.UpdateShapePropertiesRequest{
-				ObjectId: paragraphId,
-				Fields:   "shapeBackgroundFill,outline,contentAlignment",
-				ShapeProperties: &slides.ShapeProperties{
-					ContentAlignment: "TOP",
-					Outline: &slides.Outline{
-						Weight:    &slides.Dimension{Magnitude: 1, Unit: "PT"},
-						DashStyle: "SOLID",
-						OutlineFill: &slides.OutlineFill{
-							SolidFill: &slides.SolidFill{
-								Color: &slides.OpaqueColor{
-									RgbColor: &slides.RgbColor{
-										Red:   0.35,
-										Green: 0.35,
-										Blue:  0.35,
-									},
-								},
-							},
-						},
-					},
-					ShapeBackgroundFill: &slides.ShapeBackgroundFill{
-						SolidFill: &slides.SolidFill{
-							Alpha: 0.69,
-							Color: &slides.OpaqueColor{
-								RgbColor: &slides.RgbColor{
-									Red:   0.37,
-									Green: 0.37,
-									Blue:  0.37,
-								},
-							},
-						},
-					},
-				},
-			},
-		},
-		{
-			InsertText: &slides.InsertTextRequest{
-				ObjectId: paragraphId,
-				Text:     page.Paragraph,
-			},
-		},
-		{
-			UpdateParagraphStyle: &slides.UpdateParagraphStyleRequest{
-				ObjectId: paragraphId,
-				Fields:   "alignment",
-				Style: &slides.ParagraphStyle{
-					Alignment: "Start",
-				},
-			},
-		},
-		{
-			UpdateTextStyle: &slides.UpdateTextStyleRequest{
-				ObjectId: paragraphId,
-				Fields:   "bold,fontSize,foregroundColor",
-				Style: &slides.TextStyle{
-					Bold:     true,
-					FontSize: &slides.Dimension{Magnitude: 13, Unit: "PT"},
-					ForegroundColor: &slides.OptionalColor{
-						OpaqueColor: &slides.OpaqueColor{
-							RgbColor: &slides.RgbColor{
-								Red:   1.0,
-								Green: 1.0,
-								Blue:  1.0,
-							},
-						},
-					},
-				},
-			},
-		},
+// Keys from the config win, otherwise it's the usual AWS credential chain
+// (environment, ~/.aws, instance roles).
+func getUploader() (*s3manager.Uploader, error) {
+	// The uploads are already retried, and through httpClient they see
+	// Retry-After like everything else
+	config := aws.NewConfig().WithRegion(AWS_REGION).WithMaxRetries(0).WithHTTPClient(httpClient)
+	if AWS_ACCESS_KEY_ID != "" && AWS_SECRET_ACCESS_KEY != "" {
+		config = config.WithCredentials(credentials.NewStaticCredentials(AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, ""))
 	}
-}
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, err
+	}
+	uploader := s3manager.NewUploader(sess)
 
-func getFinalSlide() []*slides.Request {
-	// ctx := context.Background()
-	// client := getGoogleClient()
-	// slidesService, _ := slides.NewService(ctx, option.WithHTTPClient(client))
-
-	// presentation := &slides.Presentation{}
-	// presentation.Title = "Storybook Final Slide test"
-	// presentation.Layouts = []*slides.Page{
-	// 	{
-	// 		PageType: "LAYOUT",
-	// 	},
-	// }
-	// presentation, _ = slidesService.Presentations.Create(presentation).Do()
-	updates := slides.BatchUpdatePresentationRequest{}
-	updates.Requests = []*slides.Request{
-		{
-			CreateSlide: &slides.CreateSlideRequest{
-				ObjectId:       "finalSlide",
-				InsertionIndex: 0,
-				SlideLayoutReference: &slides.LayoutReference{
-					PredefinedLayout: "BLANK",
-				},
-			},
-		},
-		{
-			CreateImage: &slides.CreateImageRequest{
-				ObjectId: "finalImage",
-				Url:      FINAL_SLIDE_IMAGE,
-				ElementProperties: &slides.PageElementProperties{
-					PageObjectId: "finalSlide",
-					Transform: &slides.AffineTransform{
-						ScaleX:     1.05,
-						ScaleY:     1.05,
-						TranslateX: 0.0,
-						TranslateY: 0.0,
-						Unit:       "PT",
-					},
-				},
-			},
-		},
-		// I want this image to be transparent but its a readonly property in
-		// the API. WTF?!
-		// {
-		// 	UpdateImageProperties: &slides.UpdateImagePropertiesRequest{
-		// 		ObjectId: "finalImage",
-		// 		Fields:   "transparency",
-		// 		ImageProperties: &slides.ImageProperties{
-		// 			Transparency: 0.69,
-		// 		},
-		// 	},
-		// },
-		{
-			CreateShape: &slides.CreateShapeRequest{
-				ObjectId:  "madeWith",
-				ShapeType: "TEXT_BOX",
-				ElementProperties: &slides.PageElementProperties{
-					PageObjectId: "finalSlide",
-					Size: &slides.Size{
-						Width:  &slides.Dimension{Magnitude: 163.44, Unit: "PT"},
-						Height: &slides.Dimension{Magnitude: 38.16, Unit: "PT"},
-					},
-					Transform: &slides.AffineTransform{
-						ScaleX:     1.0,
-						ScaleY:     1.0,
-						TranslateX: 23.75,
-						TranslateY: 20.88,
-						Unit:       "PT",
-					},
-				},
-			},
-		},
-		{
-			InsertText: &slides.InsertTextRequest{
-				ObjectId: "madeWith",
-				Text:     "Made With",
-			},
-		},
-		{
-			UpdateParagraphStyle: &slides.UpdateParagraphStyleRequest{
-				ObjectId: "madeWith",
-				Fields:   "alignment",
-				Style: &slides.ParagraphStyle{
-					Alignment: "Start",
-				},
-			},
-		},
-		{
-			UpdateTextStyle: &slides.UpdateTextStyleRequest{
-				ObjectId: "madeWith",
-				Fields:   "bold,fontSize,fontFamily",
-				Style: &slides.TextStyle{
-					Bold:       false,
-					FontSize:   &slides.Dimension{Magnitude: 19, Unit: "PT"},
-					FontFamily: "Changa One",
-				},
-			},
-		},
-		{
-			CreateShape: &slides.CreateShapeRequest{
-				ObjectId:  "storyBook",
-				ShapeType: "TEXT_BOX",
-				ElementProperties: &slides.PageElementProperties{
-					PageObjectId: "finalSlide",
-					Size: &slides.Size{
-						Width:  &slides.Dimension{Magnitude: 543.6, Unit: "PT"},
-						Height: &slides.Dimension{Magnitude: 130.32, Unit: "PT"},
-					},
-					Transform: &slides.AffineTransform{
-						ScaleX:     1.0,
-						ScaleY:     1.0,
-						TranslateX: 0.0,
-						TranslateY: 41.01,
-						Unit:       "PT",
-					},
-				},
-			},
-		},
-		{
-			InsertText: &slides.InsertTextRequest{
-				ObjectId: "storyBook",
-				Text:     "Storybook",
-			},
-		},
-		{
-			UpdateParagraphStyle: &slides.UpdateParagraphStyleRequest{
-				ObjectId: "storyBook",
-				Fields:   "alignment",
-				Style: &slides.ParagraphStyle{
-					Alignment: "Start",
-				},
-			},
-		},
-		{
-			UpdateTextStyle: &slides.UpdateTextStyleRequest{
-				ObjectId: "storyBook",
-				Fields:   "bold,fontSize,fontFamily",
-				Style: &slides.TextStyle{
-					Bold:       true,
-					FontSize:   &slides.Dimension{Magnitude: 80, Unit: "PT"},
-					FontFamily: "Pacifico",
-				},
-			},
-		},
-		{
-			CreateShape: &slides.CreateShapeRequest{
-				ObjectId:  "howitworks",
-				ShapeType: "ROUND_RECTANGLE",
-				ElementProperties: &slides.PageElementProperties{
-					PageObjectId: "finalSlide",
-					Size: &slides.Size{
-						Width:  &slides.Dimension{Magnitude: 223.2, Unit: "PT"},
-						Height: &slides.Dimension{Magnitude: 44.64, Unit: "PT"},
-					},
-					Transform: &slides.AffineTransform{
-						ScaleX:     1.0,
-						ScaleY:     1.0,
-						TranslateX: 23.76,
-						TranslateY: 171.36,
-						Unit:       "PT",
-					},
-				},
-			},
-		},
-		{
-			UpdateShapeProperties: &slides.UpdateShapePropertiesRequest{
-				ObjectId: "howitworks",
-				Fields:   "shapeBackgroundFill,link",
-				ShapeProperties: &slides.ShapeProperties{
-					Link: &slides.Link{
-						Url: "https://github.com/MATTALUI/storybook",
-					},
-					ShapeBackgroundFill: &slides.ShapeBackgroundFill{
-						SolidFill: &slides.SolidFill{
-							Alpha: 0.85,
-							Color: &slides.OpaqueColor{
-								RgbColor: &slides.RgbColor{
-									Red:   0.93,
-									Green: 0.93,
-									Blue:  0.93,
-								},
-							},
-						},
-					},
-				},
-			},
-		},
-		{
-			InsertText: &slides.InsertTextRequest{
-				ObjectId: "howitworks",
-				Text:     "How It Works",
-			},
-		},
-		{
-			UpdateParagraphStyle: &slides.UpdateParagraphStyleRequest{
-				ObjectId: "howitworks",
-				Fields:   "alignment",
-				Style: &slides.ParagraphStyle{
-					Alignment: "Center",
-				},
-			},
-		},
-		{
-			UpdateTextStyle: &slides.UpdateTextStyleRequest{
-				ObjectId: "howitworks",
-				Fields:   "bold,fontSize,fontFamily",
-				Style: &slides.TextStyle{
-					Bold:       false,
-					FontSize:   &slides.Dimension{Magnitude: 14, Unit: "PT"},
-					FontFamily: "Changa One",
-				},
-			},
-		},
-		{
-			CreateShape: &slides.CreateShapeRequest{
-				ObjectId:  "sourcelink",
-				ShapeType: "ROUND_RECTANGLE",
-				ElementProperties: &slides.PageElementProperties{
-					PageObjectId: "finalSlide",
-					Size: &slides.Size{
-						Width:  &slides.Dimension{Magnitude: 223.2, Unit: "PT"},
-						Height: &slides.Dimension{Magnitude: 44.64, Unit: "PT"},
-					},
-					Transform: &slides.AffineTransform{
-						ScaleX:     1.0,
-						ScaleY:     1.0,
-						TranslateX: 23.76,
-						TranslateY: 225.36,
-						Unit:       "PT",
-					},
-				},
-			},
-		},
-		{
-			UpdateShapeProperties: &slides.UpdateShapePropertiesRequest{
-				ObjectId: "sourcelink",
-				Fields:   "shapeBackgroundFill,link",
-				ShapeProperties: &slides.ShapeProperties{
-					Link: &slides.Link{
-						Url: "https://github.com/MATTALUI/storybook",
-					},
-					ShapeBackgroundFill: &slides.ShapeBackgroundFill{
-						SolidFill: &slides.SolidFill{
-							Alpha: 0.85,
-							Color: &slides.OpaqueColor{
-								RgbColor: &slides.RgbColor{
-									Red:   0.93,
-									Green: 0.93,
-									Blue:  0.93,
-								},
-							},
-						},
-					},
-				},
-			},
-		},
-		{
-			InsertText: &slides.InsertTextRequest{
-				ObjectId: "sourcelink",
-				Text:     "Source",
-			},
-		},
-		{
-			UpdateParagraphStyle: &slides.UpdateParagraphStyleRequest{
-				ObjectId: "sourcelink",
-				Fields:   "alignment",
-				Style: &slides.ParagraphStyle{
-					Alignment: "Center",
-				},
-			},
-		},
-		{
-			UpdateTextStyle: &slides.UpdateTextStyleRequest{
-				ObjectId: "sourcelink",
-				Fields:   "bold,fontSize,fontFamily",
-				Style: &slides.TextStyle{
-					Bold:       false,
-					FontSize:   &slides.Dimension{Magnitude: 14, Unit: "PT"},
-					FontFamily: "Changa One",
-				},
-			},
-		},
-		{
-			CreateShape: &slides.CreateShapeRequest{
-				ObjectId:  "versionlink",
-				ShapeType: "ROUND_RECTANGLE",
-				ElementProperties: &slides.PageElementProperties{
-					PageObjectId: "finalSlide",
-					Size: &slides.Size{
-						Width:  &slides.Dimension{Magnitude: 223.2, Unit: "PT"},
-						Height: &slides.Dimension{Magnitude: 44.64, Unit: "PT"},
-					},
-					Transform: &slides.AffineTransform{
-						ScaleX:     1.0,
-						ScaleY:     1.0,
-						TranslateX: 23.76,
-						TranslateY: 279.36,
-						Unit:       "PT",
-					},
-				},
-			},
-		},
-		{
-			UpdateShapeProperties: &slides.UpdateShapePropertiesRequest{
-				ObjectId: "versionlink",
-				Fields:   "shapeBackgroundFill,link",
-				ShapeProperties: &slides.ShapeProperties{
-					Link: &slides.Link{
-						Url: "https://github.com/MATTALUI/storybook",
-					},
-					ShapeBackgroundFill: &slides.ShapeBackgroundFill{
-						SolidFill: &slides.SolidFill{
-							Alpha: 0.85,
-							Color: &slides.OpaqueColor{
-								RgbColor: &slides.RgbColor{
-									Red:   0.93,
-									Green: 0.93,
-									Blue:  0.93,
-								},
-							},
-						},
-					},
-				},
-			},
-		},
-		{
-			InsertText: &slides.InsertTextRequest{
-				ObjectId: "versionlink",
-				Text:     "Version 0.1.0",
-			},
-		},
-		{
-			UpdateParagraphStyle: &slides.UpdateParagraphStyleRequest{
-				ObjectId: "versionlink",
-				Fields:   "alignment",
-				Style: &slides.ParagraphStyle{
-					Alignment: "Center",
-				},
-			},
-		},
-		{
-			UpdateTextStyle: &slides.UpdateTextStyleRequest{
-				ObjectId: "versionlink",
-				Fields:   "bold,fontSize,fontFamily",
-				Style: &slides.TextStyle{
-					Bold:       false,
-					FontSize:   &slides.Dimension{Magnitude: 14, Unit: "PT"},
-					FontFamily: "Changa One",
-				},
-			},
-		},
-	}
-	// _, err := slidesService.Presentations.BatchUpdate(presentation.PresentationId, &updates).Do()
-	// if err != nil {
-	// 	panic(err)
-	// }
-
-	return updates.Requests
+	return uploader, nil
 }
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// quietProgress keeps the stages from chatting all over the test output.
+type quietProgress struct{}
+
+func (sink *quietProgress) Event(event ProgressEvent) {}
+func (sink *quietProgress) Say(message string)        {}
+func (sink *quietProgress) Tell(message string)       {}
+
+// The pages and covers write to ./images, so the tests run somewhere they
+// can make a mess, with the fake providers and the built-in prompts.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "storybook")
+	if err != nil {
+		panic(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		panic(err)
+	}
+
+	config := getDefaultConfig()
+	config.Text.Provider = "fake"
+	config.Image.Provider = "placeholder"
+	config.Prompts.Dir = ""
+	config.Pages.Workers = 3
+	applyConfig(config)
+	prompts, err = loadPrompts(PROMPTS_DIR)
+	if err != nil {
+		panic(err)
+	}
+	textGenerator = &FakeTextGenerator{}
+	imageGenerator = &PlaceholderImageGenerator{}
+	imageScorer = &HeuristicImageScorer{}
+	progress = &quietProgress{}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// More pages than workers, so every worker gets a few.
+func newTestStory() *Story {
+	story := buildStory()
+	story.Synopsis = StorySynopsis{Animal: "zebra", Name: "Poncho", Goal: "fly"}
+	story.ArtStyle = getArtStyle("")
+	story.Character = fakeCharacter
+	for i := 0; i < 8; i++ {
+		story.Paragraphs = append(story.Paragraphs, fmt.Sprintf("Page %d. %s", i+1, fakeStoryParagraphs[i%len(fakeStoryParagraphs)]))
+	}
+	story.Pages = make([]Page, len(story.Paragraphs))
+
+	return story
+}
+
+func getTestSettings(story *Story) pageSettings {
+	return pageSettings{
+		StoryId:        story.Id,
+		Synopsis:       story.Synopsis,
+		Character:      story.Character,
+		ArtStyle:       story.ArtStyle,
+		CoverImagePath: story.CoverImagePath,
+	}
+}
+
+func TestConstructPage(t *testing.T) {
+	story := newTestStory()
+	page, err := constructPage(context.Background(), getTestSettings(story), 3, Page{Paragraph: story.Paragraphs[3]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.ImageDescriptor == "" {
+		t.Error("the page wasn't described")
+	}
+	if len(page.ImagePrompts) == 0 || page.ImagePrompts[0].Text != page.ImageDescriptor {
+		t.Errorf("the scene should be the first image prompt, got %+v", page.ImagePrompts)
+	}
+	expected := fmt.Sprintf("./images/%s/4-1.png", story.Id)
+	if page.ImagePath != expected {
+		t.Errorf("ImagePath = %q, want %q", page.ImagePath, expected)
+	}
+	if !fileExists(page.ImagePath) {
+		t.Errorf("%s wasn't written", page.ImagePath)
+	}
+}
+
+func TestConstructPageKeepsEveryCandidate(t *testing.T) {
+	defer func(candidates int) { IMAGE_CANDIDATES = candidates }(IMAGE_CANDIDATES)
+	IMAGE_CANDIDATES = 3
+	story := newTestStory()
+	page, err := constructPage(context.Background(), getTestSettings(story), 0, Page{Paragraph: story.Paragraphs[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Candidates) != 3 {
+		t.Fatalf("got %d candidates, want 3", len(page.Candidates))
+	}
+	for _, candidate := range page.Candidates {
+		if !fileExists(candidate.Path) {
+			t.Errorf("%s wasn't written", candidate.Path)
+		}
+	}
+	if page.ImagePath != page.Candidates[page.Selected].Path {
+		t.Errorf("ImagePath %q isn't the selected candidate %q", page.ImagePath, page.Candidates[page.Selected].Path)
+	}
+}
+
+func TestBuildPagesResultsLandAtTheirIndex(t *testing.T) {
+	story := newTestStory()
+	// A page that's already done shouldn't come back
+	done, err := constructPage(context.Background(), getTestSettings(story), 2, Page{Paragraph: story.Paragraphs[2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	story.Pages[2] = done
+
+	seen := make(map[int]bool)
+	for result := range buildPages(context.Background(), story) {
+		if result.Err != nil {
+			t.Fatalf("page %d: %s", result.Index+1, result.Err)
+		}
+		if seen[result.Index] {
+			t.Errorf("page %d came back twice", result.Index+1)
+		}
+		seen[result.Index] = true
+		if result.Page.Paragraph != story.Paragraphs[result.Index] {
+			t.Errorf("page %d got the paragraph %q", result.Index+1, result.Page.Paragraph)
+		}
+		expected := fmt.Sprintf("./images/%s/%d-1.png", story.Id, result.Index+1)
+		if result.Page.ImagePath != expected {
+			t.Errorf("page %d was drawn to %q, want %q", result.Index+1, result.Page.ImagePath, expected)
+		}
+		story.Pages[result.Index] = result.Page
+	}
+
+	if seen[2] {
+		t.Error("page 3 was already done but got built again")
+	}
+	if len(seen) != len(story.Pages)-1 {
+		t.Errorf("got %d pages back, want %d", len(seen), len(story.Pages)-1)
+	}
+	for index := range story.Pages {
+		if !pageIsComplete(&story.Pages[index]) {
+			t.Errorf("page %d isn't complete", index+1)
+		}
+	}
+}
+
+// watchingTextGenerator and watchingImageGenerator write down what the story
+// looked like while the title and cover were still being made. Each one can
+// wait for the other to be done first, and signal when it is.
+type storyWatcher struct {
+	story *Story
+	wait  chan struct{}
+	done  chan struct{}
+	title string
+	cover string
+}
+
+func (watcher *storyWatcher) watch(generate func() error) error {
+	if watcher.wait != nil {
+		<-watcher.wait
+		// Long enough for the other one to get all the way back
+		time.Sleep(50 * time.Millisecond)
+	}
+	watcher.title = watcher.story.Title
+	watcher.cover = watcher.story.CoverImagePath
+	err := generate()
+	if watcher.done != nil {
+		close(watcher.done)
+	}
+
+	return err
+}
+
+type watchingTextGenerator struct {
+	FakeTextGenerator
+	storyWatcher
+}
+
+func (generator *watchingTextGenerator) Generate(ctx context.Context, prompt string) (string, error) {
+	if !strings.Contains(strings.ToLower(prompt), "title:") {
+		return generator.FakeTextGenerator.Generate(ctx, prompt)
+	}
+	var resp string
+	err := generator.watch(func() error {
+		var err error
+		resp, err = generator.FakeTextGenerator.Generate(ctx, prompt)
+		return err
+	})
+
+	return resp, err
+}
+
+type watchingImageGenerator struct {
+	PlaceholderImageGenerator
+	storyWatcher
+}
+
+func (generator *watchingImageGenerator) GenerateImages(ctx context.Context, request ImageRequest) ([]GeneratedImage, error) {
+	var images []GeneratedImage
+	err := generator.watch(func() error {
+		var err error
+		images, err = generator.PlaceholderImageGenerator.GenerateImages(ctx, request)
+		return err
+	})
+
+	return images, err
+}
+
+func TestBuildCoversSetsTheStoryAfterBothAreDone(t *testing.T) {
+	defer func(text TextGenerator, image ImageGenerator) {
+		textGenerator = text
+		imageGenerator = image
+	}(textGenerator, imageGenerator)
+
+	for _, titleFirst := range []bool{true, false} {
+		story := newTestStory()
+		watchingText := &watchingTextGenerator{storyWatcher: storyWatcher{story: story}}
+		watchingImage := &watchingImageGenerator{storyWatcher: storyWatcher{story: story}}
+		finished := make(chan struct{})
+		if titleFirst {
+			watchingText.done, watchingImage.wait = finished, finished
+		} else {
+			watchingImage.done, watchingText.wait = finished, finished
+		}
+		textGenerator = watchingText
+		imageGenerator = watchingImage
+
+		err := buildCovers(context.Background(), story)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if watchingText.title != defaultTitle || watchingImage.title != defaultTitle {
+			t.Errorf("the title changed while the covers were being made: %q, %q", watchingText.title, watchingImage.title)
+		}
+		if watchingText.cover != "" || watchingImage.cover != "" {
+			t.Errorf("the cover was set while the covers were being made: %q, %q", watchingText.cover, watchingImage.cover)
+		}
+		if story.Title != "The Very Big Dream" {
+			t.Errorf("Title = %q", story.Title)
+		}
+		expected := fmt.Sprintf("./images/%s/cover.png", story.Id)
+		if story.CoverImagePath != expected || !fileExists(story.CoverImagePath) {
+			t.Errorf("CoverImagePath = %q, want %q written", story.CoverImagePath, expected)
+		}
+		if story.TitleFailed {
+			t.Error("the title shouldn't have failed")
+		}
+	}
+}
+
+func TestBuildSlideRequestsUseEachPagesOwnImage(t *testing.T) {
+	story := newTestStory()
+	story.CoverPublicImagePath = "https://example.com/cover.png"
+	for index := range story.Pages {
+		story.Pages[index].Paragraph = story.Paragraphs[index]
+		story.Pages[index].PublicImagePath = fmt.Sprintf("https://example.com/%d.png", index)
+	}
+
+	images := 0
+	for _, request := range buildSlideRequests(story) {
+		if request.CreateImage == nil {
+			continue
+		}
+		if request.CreateImage.ObjectId == "titlecoverimage" {
+			if request.CreateImage.Url != story.CoverPublicImagePath {
+				t.Errorf("the title slide got %q", request.CreateImage.Url)
+			}
+			continue
+		}
+		var index int
+		_, err := fmt.Sscanf(request.CreateImage.ObjectId, "%d_IMAGE", &index)
+		if err != nil {
+			continue
+		}
+		images++
+		if request.CreateImage.Url != story.Pages[index].PublicImagePath {
+			t.Errorf("page %d got the image %q", index+1, request.CreateImage.Url)
+		}
+		if slideId := fmt.Sprintf("%d_SLIDE", index); request.CreateImage.ElementProperties.PageObjectId != slideId {
+			t.Errorf("page %d's image went on %q", index+1, request.CreateImage.ElementProperties.PageObjectId)
+		}
+	}
+	if images != len(story.Pages) {
+		t.Errorf("got %d page images, want %d", images, len(story.Pages))
+	}
+}
+
+// filteringImageGenerator filters everything the first time it's asked.
+type filteringImageGenerator struct {
+	PlaceholderImageGenerator
+	seeds []int
+}
+
+func (generator *filteringImageGenerator) GenerateImages(ctx context.Context, request ImageRequest) ([]GeneratedImage, error) {
+	generator.seeds = append(generator.seeds, request.Seed)
+	images, err := generator.PlaceholderImageGenerator.GenerateImages(ctx, request)
+	if len(generator.seeds) == 1 {
+		for index := range images {
+			images[index].FinishReason = "CONTENT_FILTERED"
+		}
+	}
+
+	return images, err
+}
+
+func TestFilteredPicturesAreRetriedWithAnotherSeed(t *testing.T) {
+	defer func(image ImageGenerator) { imageGenerator = image }(imageGenerator)
+	filtering := &filteringImageGenerator{}
+	imageGenerator = filtering
+	story := newTestStory()
+	story.Synopsis.Seed = 42
+
+	page, err := constructPage(context.Background(), getTestSettings(story), 0, Page{Paragraph: story.Paragraphs[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtering.seeds) != 2 {
+		t.Fatalf("drew %d times, want 2", len(filtering.seeds))
+	}
+	if filtering.seeds[0] != 42 || filtering.seeds[1] == 42 {
+		t.Errorf("drew with the seeds %v, the retry should have moved off of 42", filtering.seeds)
+	}
+	if len(page.Candidates) != 1 || !fileExists(page.ImagePath) {
+		t.Errorf("the retry should have kept its picture, got %+v", page.Candidates)
+	}
+}
+
+// brokenImageGenerator fails every time, the way a bad key would.
+type brokenImageGenerator struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (generator *brokenImageGenerator) GenerateImages(ctx context.Context, request ImageRequest) ([]GeneratedImage, error) {
+	generator.mu.Lock()
+	generator.calls++
+	generator.mu.Unlock()
+
+	return nil, &ImageGenerationError{Provider: "broken", StatusCode: 401, Body: "nope"}
+}
+
+func TestBuildPagesStopsStartingPagesAfterAFailure(t *testing.T) {
+	defer func(image ImageGenerator) { imageGenerator = image }(imageGenerator)
+	broken := &brokenImageGenerator{}
+	imageGenerator = broken
+	story := newTestStory()
+
+	failures := 0
+	for result := range buildPages(context.Background(), story) {
+		if result.Err == nil {
+			t.Errorf("page %d shouldn't have worked", result.Index+1)
+		}
+		failures++
+	}
+	if failures == 0 || failures > PAGE_WORKERS {
+		t.Errorf("got %d failed pages, want no more than the %d that were underway", failures, PAGE_WORKERS)
+	}
+	if broken.calls > PAGE_WORKERS {
+		t.Errorf("asked for %d pictures after the first one failed", broken.calls)
+	}
+}
+
+func TestFilteredCoversAreRetriedWithAnotherSeed(t *testing.T) {
+	defer func(image ImageGenerator) { imageGenerator = image }(imageGenerator)
+	filtering := &filteringImageGenerator{}
+	imageGenerator = filtering
+	story := newTestStory()
+	story.Synopsis.Seed = 42
+
+	err := buildCovers(context.Background(), story)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtering.seeds) != 2 || filtering.seeds[0] != 42 || filtering.seeds[1] == 42 {
+		t.Errorf("drew the cover with the seeds %v, the retry should have moved off of 42", filtering.seeds)
+	}
+	if !fileExists(story.CoverImagePath) {
+		t.Errorf("the cover %q wasn't written", story.CoverImagePath)
+	}
+}
+
+func TestRecordPromptsKeepsEveryVersion(t *testing.T) {
+	defer func(original map[string]promptTemplate) { prompts = original }(prompts)
+	story := newTestStory()
+	recordPrompts(story, "page")
+	first := prompts["page"].version
+
+	changed := make(map[string]promptTemplate)
+	for name, prompt := range prompts {
+		changed[name] = prompt
+	}
+	second := PromptVersion{Version: "9", Hash: "changed", Source: "prompts/page.tmpl"}
+	changed["page"] = promptTemplate{template: prompts["page"].template, version: second}
+	prompts = changed
+	recordPrompts(story, "page")
+	recordPrompts(story, "page")
+
+	if story.Prompts["page"] != first {
+		t.Errorf("Prompts[page] = %+v, want the first version %+v", story.Prompts["page"], first)
+	}
+	if len(story.ChangedPrompts["page"]) != 1 || story.ChangedPrompts["page"][0] != second {
+		t.Errorf("ChangedPrompts[page] = %+v, want just %+v", story.ChangedPrompts["page"], second)
+	}
+
+	used := map[string]PromptVersion{"page_image": first}
+	noted := notePrompts(used, "page")
+	if noted["page"] != second || noted["page_image"] != first {
+		t.Errorf("notePrompts = %+v", noted)
+	}
+	if _, ok := used["page"]; ok {
+		t.Error("notePrompts changed the map it was given")
+	}
+}
+
+// namingTextGenerator describes every scene with the character's name in it.
+type namingTextGenerator struct{}
+
+func (generator *namingTextGenerator) Generate(ctx context.Context, prompt string) (string, error) {
+	return "Poncho flaps his arms on top of the hill", nil
+}
+
+func TestPageDescriptorsCallTheCharacterByTheirAnimal(t *testing.T) {
+	defer func(text TextGenerator) { textGenerator = text }(textGenerator)
+	textGenerator = &namingTextGenerator{}
+	story := newTestStory()
+	page := Page{Paragraph: story.Paragraphs[0]}
+
+	err := buildPageDescriptors(context.Background(), getTestSettings(story), &page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(page.ImageDescriptor, "poncho") {
+		t.Errorf("the name is still in %q", page.ImageDescriptor)
+	}
+	if !strings.Contains(page.ImageDescriptor, "the zebra flaps") {
+		t.Errorf("the zebra isn't in %q", page.ImageDescriptor)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Everything we've paid for so far gets written down next to the images
+// after every stage, so a crash doesn't mean starting over from scratch.
+var manifestMutex sync.Mutex
+
+func getManifestPath(id string) string {
+	return fmt.Sprintf("./images/%s/story.json", id)
+}
+
+func saveManifest(story *Story) {
+	manifestMutex.Lock()
+	defer manifestMutex.Unlock()
+
+	os.MkdirAll(fmt.Sprintf("./images/%s", story.Id), os.ModePerm)
+	manifestBytes, err := json.MarshalIndent(story, "", "  ")
+	if err != nil {
+		if DEBUG {
+			panic(err)
+		}
+		tell("I couldn't jot down my notes. Hopefully nothing goes wrong...")
+		return
+	}
+	// Write to the side and swap it in so a crash mid-write can't eat the
+	// last good manifest
+	filePath := getManifestPath(story.Id.String())
+	err = os.WriteFile(filePath+".tmp", manifestBytes, 0644)
+	if err == nil {
+		err = os.Rename(filePath+".tmp", filePath)
+	}
+	if err != nil {
+		if DEBUG {
+			panic(err)
+		}
+		tell("I couldn't jot down my notes. Hopefully nothing goes wrong...")
+	}
+}
+
+func loadManifest(id string) (*Story, error) {
+	manifestBytes, err := os.ReadFile(getManifestPath(id))
+	if err != nil {
+		return nil, err
+	}
+	story := &Story{}
+	err = json.Unmarshal(manifestBytes, story)
+	if err != nil {
+		return nil, err
+	}
+	if story.Outputs == nil {
+		story.Outputs = make(map[string]string)
+	}
+	// CoverImage started out as FINAL_SLIDE_IMAGE and only became the cover
+	// once it was uploaded
+	if story.CoverPublicImagePath == "" && strings.Contains(story.CoverImage, fmt.Sprintf("%s_cover.png", story.Id)) {
+		story.CoverPublicImagePath = story.CoverImage
+	}
+
+	return story, nil
+}
+
+func fileExists(path string) bool {
+	if path == "" {
+		return false
+	}
+	_, err := os.Stat(path)
+
+	return err == nil
+}
+
+func pageIsComplete(page *Page) bool {
+	return page.ImageDescriptor != "" && fileExists(page.ImagePath)
+}
+
+// Names the first stage the story hasn't gotten through yet, or "" when
+// everything (publishing included) is done.
+func getIncompleteStage(story *Story, publisherNames []string) string {
+	if story.RawGPTResponse == "" {
+		return "story"
+	}
+	if len(story.Paragraphs) == 0 {
+		return "paragraphs"
+	}
+	if len(story.Readability) != len(story.Paragraphs) && len(story.Pages) == 0 {
+		return "reading level"
+	}
+	if story.Character.isEmpty() {
+		return "character"
+	}
+	if story.Title == defaultTitle && !story.TitleFailed {
+		return "title"
+	}
+	if !fileExists(story.CoverImagePath) {
+		return "cover"
+	}
+	if len(story.Pages) != len(story.Paragraphs) {
+		return "pages"
+	}
+	for index := range story.Pages {
+		if !pageIsComplete(&story.Pages[index]) {
+			return fmt.Sprintf("page %d", index+1)
+		}
+	}
+	for _, name := range publisherNames {
+		if _, done := story.Outputs[name]; !done {
+			return fmt.Sprintf("publish %s", name)
+		}
+	}
+
+	return ""
+}
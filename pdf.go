@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The PDF mirrors the slide deck, so pages are the same 720x405pt a Google
+// slide is and everything is positioned with the same numbers the Slides
+// requests use (top left origin). The page flips it for PDF.
+const (
+	pdfPageWidth  = 720.0
+	pdfPageHeight = 405.0
+)
+
+type PDFPublisher struct{}
+
+func (publisher *PDFPublisher) Name() string {
+	return "pdf"
+}
+
+func (publisher *PDFPublisher) Publish(ctx context.Context, story *Story) (string, error) {
+	say("Let me print this out real quick...")
+	doc := newPDFDocument(story.Title)
+
+	coverPath := story.CoverImagePath
+	if coverPath == "" {
+		coverPath = fmt.Sprintf("./images/%s/cover.png", story.Id)
+	}
+	cover := doc.newPage()
+	err := cover.drawImage(coverPath)
+	if err != nil {
+		return "", err
+	}
+	cover.fillRect(0, 0, pdfPageWidth, pdfPageHeight, pdfColor{0.37, 0.37, 0.37}, 0.5)
+	cover.drawTextBox(story.Title, helveticaBold, 80, 0, 0, pdfPageWidth, pdfPageHeight, pdfColor{1, 1, 1}, "center", "middle")
+
+	for _, page := range story.Pages {
+		spread := doc.newPage()
+		err := spread.drawImage(page.ImagePath)
+		if err != nil {
+			return "", err
+		}
+		spread.fillRect(15, 15, 269, 360, pdfColor{0.37, 0.37, 0.37}, 0.69)
+		spread.strokeRect(15, 15, 269, 360, pdfColor{0.35, 0.35, 0.35}, 1)
+		spread.drawTextBox(page.Paragraph, helveticaBold, 13, 15, 15, 269, 360, pdfColor{1, 1, 1}, "start", "top")
+	}
+
+	buildFinalPDFPage(doc)
+
+	os.MkdirAll(fmt.Sprintf("./images/%s", story.Id), os.ModePerm)
+	filePath := fmt.Sprintf("./images/%s/story.pdf", story.Id)
+	err = doc.save(filePath)
+	if err != nil {
+		return "", err
+	}
+	tell(fmt.Sprintf("Your book is ready to print at %s", filePath))
+
+	return filePath, nil
+}
+
+// Same layout getFinalSlide builds for the deck.
+func buildFinalPDFPage(doc *pdfDocument) {
+	final := doc.newPage()
+	if _, err := os.Stat(FINAL_SLIDE_IMAGE); err == nil {
+		final.drawImage(FINAL_SLIDE_IMAGE)
+	}
+	black := pdfColor{0, 0, 0}
+	final.drawTextBox("Made With", helvetica, 19, 23.75, 20.88, 163.44, 38.16, black, "start", "top")
+	final.drawTextBox("Storybook", helveticaBold, 80, 0.0, 41.01, 543.6, 130.32, black, "start", "top")
+	buttons := []string{"How It Works", "Source", "Version 0.1.0"}
+	for index, label := range buttons {
+		y := 171.36 + float64(index)*54
+		final.fillRoundedRect(23.76, y, 223.2, 44.64, 8, pdfColor{0.93, 0.93, 0.93}, 0.85)
+		final.drawTextBox(label, helvetica, 14, 23.76, y, 223.2, 44.64, black, "center", "middle")
+		final.addLink(23.76, y, 223.2, 44.64, "https://github.com/MATTALUI/storybook")
+	}
+}
+
+type pdfColor struct {
+	R float64
+	G float64
+	B float64
+}
+
+type pdfFont struct {
+	Resource string
+	BaseFont string
+	Widths   [95]int
+	Extras   map[byte]int
+}
+
+// Glyph widths for the printable ASCII range, straight out of the AFM files
+// for the standard 14 fonts, so text can be wrapped without embedding a font.
+var helvetica = &pdfFont{
+	Resource: "F1",
+	BaseFont: "Helvetica",
+	Widths: [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	},
+	Extras: map[byte]int{0x85: 1000, 0x91: 222, 0x92: 222, 0x93: 333, 0x94: 333, 0x95: 350, 0x96: 556, 0x97: 1000},
+}
+
+var helveticaBold = &pdfFont{
+	Resource: "F2",
+	BaseFont: "Helvetica-Bold",
+	Widths: [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	},
+	Extras: map[byte]int{0x85: 1000, 0x91: 278, 0x92: 278, 0x93: 500, 0x94: 500, 0x95: 350, 0x96: 556, 0x97: 1000},
+}
+
+var winAnsiExtras = map[rune]byte{
+	'…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+}
+
+// GPT likes its curly quotes, which live outside latin-1 in WinAnsi.
+func encodeWinAnsi(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r >= 32 && r <= 126:
+			encoded = append(encoded, byte(r))
+		case r >= 0xA0 && r <= 0xFF:
+			encoded = append(encoded, byte(r))
+		case winAnsiExtras[r] != 0:
+			encoded = append(encoded, winAnsiExtras[r])
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+
+	return encoded
+}
+
+func (font *pdfFont) measure(text string, size float64) float64 {
+	total := 0
+	for _, b := range encodeWinAnsi(text) {
+		switch {
+		case b >= 32 && b <= 126:
+			total += font.Widths[b-32]
+		case font.Extras[b] != 0:
+			total += font.Extras[b]
+		default:
+			total += 556
+		}
+	}
+
+	return float64(total) * size / 1000
+}
+
+func wrapText(text string, font *pdfFont, size float64, maxWidth float64) []string {
+	lines := make([]string, 0)
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if line != "" && font.measure(candidate, size) > maxWidth {
+				lines = append(lines, line)
+				line = word
+			} else {
+				line = candidate
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func escapePDFString(text string) string {
+	encoded := encodeWinAnsi(text)
+	var buffer bytes.Buffer
+	for _, b := range encoded {
+		if b == '(' || b == ')' || b == '\\' {
+			buffer.WriteByte('\\')
+		}
+		buffer.WriteByte(b)
+	}
+
+	return buffer.String()
+}
+
+type pdfImage struct {
+	Resource string
+	Width    int
+	Height   int
+	Object   int
+}
+
+type pdfLink struct {
+	Rect string
+	URL  string
+}
+
+type pdfPage struct {
+	doc     *pdfDocument
+	content bytes.Buffer
+	links   []pdfLink
+}
+
+type pdfDocument struct {
+	title   string
+	objects [][]byte
+	pages   []*pdfPage
+	images  map[string]*pdfImage
+	alphas  map[string]float64
+}
+
+func newPDFDocument(title string) *pdfDocument {
+	return &pdfDocument{
+		title:   title,
+		objects: make([][]byte, 0),
+		pages:   make([]*pdfPage, 0),
+		images:  make(map[string]*pdfImage),
+		alphas:  make(map[string]float64),
+	}
+}
+
+func (doc *pdfDocument) addObject(body []byte) int {
+	doc.objects = append(doc.objects, body)
+	return len(doc.objects)
+}
+
+func (doc *pdfDocument) newPage() *pdfPage {
+	page := &pdfPage{doc: doc}
+	doc.pages = append(doc.pages, page)
+
+	return page
+}
+
+// Images are re-encoded as JPEG since PDF can embed those as-is with
+// DCTDecode. The same file is only ever embedded once.
+func (doc *pdfDocument) addImage(path string) (*pdfImage, error) {
+	if existing, ok := doc.images[path]; ok {
+		return existing, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	decoded, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	err = jpeg.Encode(&buffer, decoded, &jpeg.Options{Quality: 92})
+	if err != nil {
+		return nil, err
+	}
+	bounds := decoded.Bounds()
+	header := fmt.Sprintf(
+		"<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode /Length %d >>\nstream\n",
+		bounds.Dx(),
+		bounds.Dy(),
+		buffer.Len(),
+	)
+	body := append([]byte(header), buffer.Bytes()...)
+	body = append(body, []byte("\nendstream")...)
+
+	pdfImage := &pdfImage{
+		Resource: fmt.Sprintf("Im%d", len(doc.images)),
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		Object:   doc.addObject(body),
+	}
+	doc.images[path] = pdfImage
+
+	return pdfImage, nil
+}
+
+func (doc *pdfDocument) alpha(value float64) string {
+	name := fmt.Sprintf("A%d", int(value*100))
+	doc.alphas[name] = value
+
+	return name
+}
+
+func (doc *pdfDocument) save(filePath string) error {
+	fonts := []*pdfFont{helvetica, helveticaBold}
+	fontRefs := ""
+	for _, font := range fonts {
+		id := doc.addObject([]byte(fmt.Sprintf(
+			"<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>",
+			font.BaseFont,
+		)))
+		fontRefs += fmt.Sprintf("/%s %d 0 R ", font.Resource, id)
+	}
+	alphaNames := make([]string, 0, len(doc.alphas))
+	for name := range doc.alphas {
+		alphaNames = append(alphaNames, name)
+	}
+	sort.Strings(alphaNames)
+	alphaRefs := ""
+	for _, name := range alphaNames {
+		alphaRefs += fmt.Sprintf("/%s << /Type /ExtGState /ca %.2f >> ", name, doc.alphas[name])
+	}
+	imageRefs := ""
+	for _, pdfImage := range doc.images {
+		imageRefs += fmt.Sprintf("/%s %d 0 R ", pdfImage.Resource, pdfImage.Object)
+	}
+	resources := doc.addObject([]byte(fmt.Sprintf(
+		"<< /Font << %s>> /ExtGState << %s>> /XObject << %s>> >>",
+		fontRefs,
+		alphaRefs,
+		imageRefs,
+	)))
+
+	// The page tree has to know its kids and the kids have to know their
+	// parent, so reserve the tree's number up front
+	pagesId := doc.addObject(nil)
+	kids := make([]string, 0, len(doc.pages))
+	for _, page := range doc.pages {
+		contentBytes := page.content.Bytes()
+		contents := doc.addObject([]byte(fmt.Sprintf(
+			"<< /Length %d >>\nstream\n%s\nendstream",
+			len(contentBytes),
+			contentBytes,
+		)))
+		annots := ""
+		for _, link := range page.links {
+			annots += fmt.Sprintf(
+				"<< /Type /Annot /Subtype /Link /Rect [%s] /Border [0 0 0] /A << /S /URI /URI (%s) >> >> ",
+				link.Rect,
+				escapePDFString(link.URL),
+			)
+		}
+		pageId := doc.addObject([]byte(fmt.Sprintf(
+			"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources %d 0 R /Contents %d 0 R /Annots [%s] >>",
+			pagesId,
+			pdfPageWidth,
+			pdfPageHeight,
+			resources,
+			contents,
+			annots,
+		)))
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageId))
+	}
+	doc.objects[pagesId-1] = []byte(fmt.Sprintf(
+		"<< /Type /Pages /Kids [%s] /Count %d >>",
+		strings.Join(kids, " "),
+		len(kids),
+	))
+	catalog := doc.addObject([]byte(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesId)))
+	info := doc.addObject([]byte(fmt.Sprintf("<< /Title (%s) /Producer (Storybook) >>", escapePDFString(doc.title))))
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(doc.objects))
+	for index, body := range doc.objects {
+		offsets[index] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n", index+1)
+		out.Write(body)
+		out.WriteString("\nendobj\n")
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(doc.objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(
+		&out,
+		"trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(doc.objects)+1,
+		catalog,
+		info,
+		xref,
+	)
+
+	return os.WriteFile(filePath, out.Bytes(), 0644)
+}
+
+// Draws the image so it covers the whole page, cropping whatever hangs off
+// the edges the same way the slides do.
+func (page *pdfPage) drawImage(path string) error {
+	pdfImage, err := page.doc.addImage(path)
+	if err != nil {
+		return err
+	}
+	aspect := float64(pdfImage.Width) / float64(pdfImage.Height)
+	width := pdfPageWidth
+	height := pdfPageWidth / aspect
+	if height < pdfPageHeight {
+		height = pdfPageHeight
+		width = pdfPageHeight * aspect
+	}
+	x := (pdfPageWidth - width) / 2
+	y := (pdfPageHeight - height) / 2
+	fmt.Fprintf(&page.content, "q %.2f 0 0 %.2f %.2f %.2f cm /%s Do Q\n", width, height, x, y, pdfImage.Resource)
+
+	return nil
+}
+
+func (page *pdfPage) fillRect(x, y, width, height float64, fill pdfColor, alpha float64) {
+	fmt.Fprintf(
+		&page.content,
+		"q /%s gs %.3f %.3f %.3f rg %.2f %.2f %.2f %.2f re f Q\n",
+		page.doc.alpha(alpha),
+		fill.R, fill.G, fill.B,
+		x, pdfPageHeight-y-height, width, height,
+	)
+}
+
+func (page *pdfPage) strokeRect(x, y, width, height float64, stroke pdfColor, weight float64) {
+	fmt.Fprintf(
+		&page.content,
+		"q %.2f w %.3f %.3f %.3f RG %.2f %.2f %.2f %.2f re S Q\n",
+		weight,
+		stroke.R, stroke.G, stroke.B,
+		x, pdfPageHeight-y-height, width, height,
+	)
+}
+
+func (page *pdfPage) fillRoundedRect(x, y, width, height, radius float64, fill pdfColor, alpha float64) {
+	// Bezier control point distance for a quarter circle
+	k := radius * 0.5523
+	left := x
+	bottom := pdfPageHeight - y - height
+	right := x + width
+	top := bottom + height
+	fmt.Fprintf(&page.content, "q /%s gs %.3f %.3f %.3f rg\n", page.doc.alpha(alpha), fill.R, fill.G, fill.B)
+	fmt.Fprintf(&page.content, "%.2f %.2f m\n", left+radius, bottom)
+	fmt.Fprintf(&page.content, "%.2f %.2f l\n", right-radius, bottom)
+	fmt.Fprintf(&page.content, "%.2f %.2f %.2f %.2f %.2f %.2f c\n", right-radius+k, bottom, right, bottom+radius-k, right, bottom+radius)
+	fmt.Fprintf(&page.content, "%.2f %.2f l\n", right, top-radius)
+	fmt.Fprintf(&page.content, "%.2f %.2f %.2f %.2f %.2f %.2f c\n", right, top-radius+k, right-radius+k, top, right-radius, top)
+	fmt.Fprintf(&page.content, "%.2f %.2f l\n", left+radius, top)
+	fmt.Fprintf(&page.content, "%.2f %.2f %.2f %.2f %.2f %.2f c\n", left+radius-k, top, left, top-radius+k, left, top-radius)
+	fmt.Fprintf(&page.content, "%.2f %.2f l\n", left, bottom+radius)
+	fmt.Fprintf(&page.content, "%.2f %.2f %.2f %.2f %.2f %.2f c\n", left, bottom+radius-k, left+radius-k, bottom, left+radius, bottom)
+	page.content.WriteString("h f Q\n")
+}
+
+// Wraps the text into the box, shrinking the font until it all fits, the
+// way Slides autofits a text box.
+func (page *pdfPage) drawTextBox(text string, font *pdfFont, size, x, y, width, height float64, fill pdfColor, align string, valign string) {
+	padding := 7.2
+	innerWidth := width - padding*2
+	innerHeight := height - padding*2
+	lines := wrapText(text, font, size, innerWidth)
+	for size > 6 && float64(len(lines))*size*1.2 > innerHeight {
+		size -= 1
+		lines = wrapText(text, font, size, innerWidth)
+	}
+	leading := size * 1.2
+	top := y + padding
+	if valign == "middle" {
+		top = y + (height-float64(len(lines))*leading)/2
+	}
+
+	fmt.Fprintf(&page.content, "BT /%s %.2f Tf %.3f %.3f %.3f rg\n", font.Resource, size, fill.R, fill.G, fill.B)
+	for index, line := range lines {
+		lineX := x + padding
+		if align == "center" {
+			lineX = x + (width-font.measure(line, size))/2
+		}
+		// The baseline sits roughly 80% of the way down the line
+		baseline := top + float64(index)*leading + size*0.8 + (leading-size)/2
+		fmt.Fprintf(
+			&page.content,
+			"1 0 0 1 %.2f %.2f Tm (%s) Tj\n",
+			lineX,
+			pdfPageHeight-baseline,
+			escapePDFString(line),
+		)
+	}
+	page.content.WriteString("ET\n")
+}
+
+func (page *pdfPage) addLink(x, y, width, height float64, url string) {
+	page.links = append(page.links, pdfLink{
+		Rect: fmt.Sprintf("%.2f %.2f %.2f %.2f", x, pdfPageHeight-y-height, x+width, pdfPageHeight-y),
+		URL:  url,
+	})
+}
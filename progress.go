@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ProgressEvent is one thing happening to one stage of one story. Status is
+// one of started, retrying, finished, failed or skipped.
+type ProgressEvent struct {
+	Time      time.Time
+	Story     string `json:",omitempty"`
+	Stage     string
+	Page      int    `json:",omitempty"`
+	Publisher string `json:",omitempty"`
+	Status    string
+	Elapsed   float64 `json:",omitempty"`
+	Tokens    int     `json:",omitempty"`
+	Images    int     `json:",omitempty"`
+	Total     int     `json:",omitempty"`
+	Output    string  `json:",omitempty"`
+	Error     string  `json:",omitempty"`
+}
+
+// ProgressSink is where the events (and anything we have to say along the
+// way) end up. Say is flavor that's fine to drop, Tell is something the
+// person running us needs to see.
+type ProgressSink interface {
+	Event(event ProgressEvent)
+	Say(message string)
+	Tell(message string)
+}
+
+var progress ProgressSink = &PlainProgress{Quips: true}
+
+func say(message string) {
+	progress.Say(message)
+}
+
+func tell(message string) {
+	progress.Tell(message)
+}
+
+func addProgressFlags(flags *flag.FlagSet) (*string, *bool) {
+	mode := flags.String("progress", "auto", "how to show progress: auto, bars, plain, or json")
+	quips := flags.Bool("quips", true, "chat along the way")
+
+	return mode, quips
+}
+
+func setupProgress(mode string, quips bool) {
+	if mode == "auto" {
+		mode = "plain"
+		if isTerminal(os.Stdout) {
+			mode = "bars"
+		}
+	}
+	switch mode {
+	case "bars":
+		progress = &TerminalProgress{Quips: quips, Out: os.Stdout}
+	case "plain":
+		progress = &PlainProgress{Quips: quips}
+	case "json":
+		progress = &JSONProgress{Quips: quips}
+	default:
+		fmt.Printf("I don't know how to show progress as %q. Try auto, bars, plain, or json.\n", mode)
+		os.Exit(2)
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	// /dev/null is a character device too
+	null, err := os.Stat(os.DevNull)
+
+	return err != nil || !os.SameFile(info, null)
+}
+
+// A stageRun is a stage that's underway. It rides along on the context so
+// the API calls underneath can report what they used and when they're
+// retrying without knowing anything about stages.
+type stageRun struct {
+	event   ProgressEvent
+	started time.Time
+	tokens  int64
+	images  int64
+}
+
+type storyKey struct{}
+
+type stageRunKey struct{}
+
+func withStory(ctx context.Context, id uuid.UUID) context.Context {
+	return context.WithValue(ctx, storyKey{}, id.String())
+}
+
+func startStage(ctx context.Context, stage string, page int, publisher string) (context.Context, *stageRun) {
+	storyId, _ := ctx.Value(storyKey{}).(string)
+	run := &stageRun{
+		event: ProgressEvent{
+			Story:     storyId,
+			Stage:     stage,
+			Page:      page,
+			Publisher: publisher,
+		},
+		started: time.Now(),
+	}
+	run.emit("started", nil)
+
+	return context.WithValue(ctx, stageRunKey{}, run), run
+}
+
+func (run *stageRun) finish(err error) {
+	if err != nil {
+		run.emit("failed", err)
+		return
+	}
+	run.emit("finished", nil)
+}
+
+func (run *stageRun) emit(status string, err error) {
+	event := run.event
+	event.Time = time.Now()
+	event.Status = status
+	if status != "started" {
+		event.Elapsed = time.Since(run.started).Seconds()
+		event.Tokens = int(atomic.LoadInt64(&run.tokens))
+		event.Images = int(atomic.LoadInt64(&run.images))
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	progress.Event(event)
+}
+
+// For things that are already done and don't need a stage to run.
+func emitSkipped(ctx context.Context, stage string, page int) {
+	storyId, _ := ctx.Value(storyKey{}).(string)
+	progress.Event(ProgressEvent{Time: time.Now(), Story: storyId, Stage: stage, Page: page, Status: "skipped"})
+}
+
+func recordUsage(ctx context.Context, tokens int, images int) {
+	run, ok := ctx.Value(stageRunKey{}).(*stageRun)
+	if !ok {
+		return
+	}
+	atomic.AddInt64(&run.tokens, int64(tokens))
+	atomic.AddInt64(&run.images, int64(images))
+}
+
+func recordRetry(ctx context.Context, err error, delay time.Duration) {
+	run, ok := ctx.Value(stageRunKey{}).(*stageRun)
+	if !ok {
+		return
+	}
+	run.emit("retrying", fmt.Errorf("%s (trying again in %s)", err, delay.Round(time.Millisecond)))
+}
+
+func describeEvent(event ProgressEvent) string {
+	name := event.Stage
+	if event.Page > 0 && strings.HasPrefix(name, "page ") {
+		name = strings.Replace(name, "page", fmt.Sprintf("page %d", event.Page), 1)
+	} else if event.Page > 0 {
+		name = fmt.Sprintf("%s page %d", name, event.Page)
+	}
+	if event.Publisher != "" {
+		name = fmt.Sprintf("%s %s", name, event.Publisher)
+	}
+	switch event.Status {
+	case "finished":
+		return fmt.Sprintf("%s finished in %.1fs", name, event.Elapsed)
+	case "failed", "retrying":
+		return fmt.Sprintf("%s %s: %s", name, event.Status, event.Error)
+	}
+
+	return fmt.Sprintf("%s %s", name, event.Status)
+}
+
+// PlainProgress prints a line at a time, which is what you want in a log
+// file. Every stage that finishes, fails or retries gets its line, and with
+// quips on it chats and exclaims on top of that like the Storybook of old.
+type PlainProgress struct {
+	Quips bool
+	mutex sync.Mutex
+}
+
+func (sink *PlainProgress) Event(event ProgressEvent) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if event.Status == "started" {
+		return
+	}
+	fmt.Println(describeEvent(event))
+	if sink.Quips {
+		if event.Stage == "page illustration" && event.Status == "finished" {
+			fmt.Println(getExclamation())
+		}
+		if event.Status == "retrying" {
+			fmt.Println("Wait, let me retry that one...")
+		}
+	}
+}
+
+func (sink *PlainProgress) Say(message string) {
+	if !sink.Quips {
+		return
+	}
+	sink.Tell(message)
+}
+
+func (sink *PlainProgress) Tell(message string) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	fmt.Println(message)
+}
+
+// JSONProgress writes every event as a line of JSON on stdout for whatever
+// is driving us. Anything meant for a person goes to stderr instead.
+type JSONProgress struct {
+	Quips bool
+	mutex sync.Mutex
+}
+
+func (sink *JSONProgress) Event(event ProgressEvent) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	eventBytes, _ := json.Marshal(event)
+	os.Stdout.Write(append(eventBytes, '\n'))
+}
+
+func (sink *JSONProgress) Say(message string) {
+	if !sink.Quips {
+		return
+	}
+	sink.Tell(message)
+}
+
+func (sink *JSONProgress) Tell(message string) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	fmt.Fprintln(os.Stderr, message)
+}
+
+// TerminalProgress keeps a little board at the bottom of the terminal with a
+// bar for every page, redrawn in place as events come in. Anything said
+// along the way is printed above it.
+type TerminalProgress struct {
+	Quips bool
+	Out   io.Writer
+
+	mutex      sync.Mutex
+	drawn      int
+	stages     map[string]string
+	pages      []string
+	publishers []string
+	tokens     int
+	images     int
+}
+
+var pageBarSteps = map[string]int{
+	"waiting":      0,
+	"describing":   3,
+	"illustrating": 6,
+	"done":         10,
+	"failed":       10,
+}
+
+func (sink *TerminalProgress) Event(event ProgressEvent) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if sink.stages == nil {
+		sink.stages = make(map[string]string)
+	}
+	if event.Status == "finished" || event.Status == "failed" {
+		sink.tokens += event.Tokens
+		sink.images += event.Images
+	}
+
+	switch {
+	case event.Stage == "pages":
+		for len(sink.pages) < event.Total {
+			sink.pages = append(sink.pages, "waiting")
+		}
+	case event.Page > 0 && strings.HasPrefix(event.Stage, "page"):
+		for len(sink.pages) < event.Page {
+			sink.pages = append(sink.pages, "waiting")
+		}
+		sink.pages[event.Page-1] = getPageState(event)
+	case event.Stage == "publish":
+		name := event.Publisher
+		found := false
+		for _, publisher := range sink.publishers {
+			found = found || publisher == name
+		}
+		if !found {
+			sink.publishers = append(sink.publishers, name)
+		}
+		sink.stages["publish "+name] = getStageState(event)
+	default:
+		sink.stages[event.Stage] = getStageState(event)
+	}
+	if sink.Quips && event.Stage == "page illustration" && event.Status == "finished" {
+		sink.printAbove(getExclamation())
+		return
+	}
+	sink.redraw()
+}
+
+func getPageState(event ProgressEvent) string {
+	switch {
+	case event.Status == "failed":
+		return "failed"
+	case event.Status == "skipped", event.Stage == "page illustration" && event.Status == "finished":
+		return "done"
+	case event.Stage == "page illustration":
+		return "illustrating"
+	}
+
+	return "describing"
+}
+
+func getStageState(event ProgressEvent) string {
+	switch event.Status {
+	case "finished":
+		return fmt.Sprintf("✓ %.1fs", event.Elapsed)
+	case "skipped":
+		return "✓"
+	case "failed":
+		return "✗ failed"
+	case "retrying":
+		return "… retrying"
+	}
+
+	return "…"
+}
+
+func (sink *TerminalProgress) Say(message string) {
+	if !sink.Quips {
+		return
+	}
+	sink.Tell(message)
+}
+
+func (sink *TerminalProgress) Tell(message string) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	sink.printAbove(message)
+}
+
+func (sink *TerminalProgress) printAbove(message string) {
+	if sink.drawn > 0 {
+		fmt.Fprintf(sink.Out, "\033[%dA", sink.drawn)
+	}
+	for _, line := range strings.Split(message, "\n") {
+		fmt.Fprintf(sink.Out, "\r\033[K%s\n", line)
+	}
+	sink.drawn = 0
+	sink.redraw()
+}
+
+func (sink *TerminalProgress) redraw() {
+	lines := make([]string, 0)
+	for _, stage := range []string{"Story", "Title", "Cover"} {
+		if state, ok := sink.stages[strings.ToLower(stage)]; ok {
+			lines = append(lines, fmt.Sprintf("%-8s %s", stage, state))
+		}
+	}
+	for index, state := range sink.pages {
+		steps := pageBarSteps[state]
+		lines = append(lines, fmt.Sprintf("Page %-3d %s%s %s", index+1, strings.Repeat("█", steps), strings.Repeat("░", 10-steps), state))
+	}
+	for _, publisher := range sink.publishers {
+		lines = append(lines, fmt.Sprintf("%-8s %s", publisher, sink.stages["publish "+publisher]))
+	}
+	if len(lines) == 0 {
+		return
+	}
+	lines = append(lines, fmt.Sprintf("%d tokens, %d images", sink.tokens, sink.images))
+
+	if sink.drawn > 0 {
+		fmt.Fprintf(sink.Out, "\033[%dA", sink.drawn)
+	}
+	for _, line := range lines {
+		fmt.Fprintf(sink.Out, "\r\033[K%s\n", line)
+	}
+	sink.drawn = len(lines)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// The prompts that ship with Storybook. Any of them can be swapped out by
+// dropping a file with the same name in PROMPTS_DIR.
+//
+//go:embed prompts/*.tmpl
+var defaultPrompts embed.FS
+
+var promptNames = []string{"story", "story_structured", "rewrite", "character", "title", "cover", "cover_image", "page", "page_image", "character_image"}
+
+// PromptData is everything a prompt template gets to work with. Not every
+// prompt uses every field, and Style is only filled in for the image ones.
+type PromptData struct {
+	Animal           string
+	Name             string
+	Goal             string
+	Style            string
+	Length           int
+	Audience         string
+	Instructions     string
+	MaxWords         int
+	MaxSentenceWords int
+	Excerpt          string
+	Hint             string
+	Character        string
+	Story            string
+	Description      string
+}
+
+// PromptVersion is what the manifest keeps about each prompt so a story can
+// be traced back to exactly what was asked. The version comes from a
+// {{/* version: ... */}} comment at the top of the template and the hash
+// catches edits that forgot to bump it.
+type PromptVersion struct {
+	Version string
+	Hash    string
+	Source  string
+}
+
+type promptTemplate struct {
+	template *template.Template
+	version  PromptVersion
+}
+
+var prompts map[string]promptTemplate
+
+var promptVersionPattern = regexp.MustCompile(`^\{\{-?\s*/\*\s*version:\s*(\S+)\s*\*/\s*-?\}\}`)
+
+func setupPrompts() {
+	loaded, err := loadPrompts(PROMPTS_DIR)
+	if err != nil {
+		fmt.Printf("One of the prompts doesn't make sense to me: %s\n", err)
+		os.Exit(2)
+	}
+	prompts = loaded
+}
+
+func loadPrompts(dir string) (map[string]promptTemplate, error) {
+	loaded := make(map[string]promptTemplate)
+	for _, name := range promptNames {
+		fileName := name + ".tmpl"
+		source := "builtin"
+		text, err := defaultPrompts.ReadFile("prompts/" + fileName)
+		if err != nil {
+			return nil, err
+		}
+		if dir != "" {
+			overridePath := filepath.Join(dir, fileName)
+			overrideText, err := os.ReadFile(overridePath)
+			if err == nil {
+				text = overrideText
+				source = overridePath
+			} else if !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+
+		parsed, err := template.New(name).Parse(string(text))
+		if err != nil {
+			return nil, err
+		}
+		// A field that doesn't exist only turns up when the template runs, so
+		// find out now instead of halfway through a story
+		err = parsed.Execute(io.Discard, PromptData{})
+		if err != nil {
+			return nil, err
+		}
+		version := "unversioned"
+		if match := promptVersionPattern.FindSubmatch(text); match != nil {
+			version = string(match[1])
+		}
+		sum := sha256.Sum256(text)
+		loaded[name] = promptTemplate{
+			template: parsed,
+			version: PromptVersion{
+				Version: version,
+				Hash:    hex.EncodeToString(sum[:])[:12],
+				Source:  source,
+			},
+		}
+	}
+
+	return loaded, nil
+}
+
+func renderPrompt(name string, data PromptData) (string, error) {
+	prompt, ok := prompts[name]
+	if !ok {
+		return "", fmt.Errorf("there's no %q prompt", name)
+	}
+	var buffer bytes.Buffer
+	err := prompt.template.Execute(&buffer, data)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(buffer.String()), nil
+}
+
+func getPromptData(synopsis StorySynopsis) PromptData {
+	audience, _ := getAudience(synopsis.Audience)
+	length := synopsis.Length
+	if length == 0 {
+		length = audience.Paragraphs
+	}
+
+	return PromptData{
+		Animal:           synopsis.Animal,
+		Name:             synopsis.Name,
+		Goal:             synopsis.Goal,
+		Length:           length,
+		Audience:         audience.Description,
+		Instructions:     audience.Instructions,
+		MaxWords:         audience.MaxWords,
+		MaxSentenceWords: audience.MaxSentenceWords,
+	}
+}
+
+// Writes down the prompts a stage is about to use, right before it runs. The
+// manifest keeps the version a prompt was first used with in Prompts, and
+// any that came in after it in ChangedPrompts, so a story that gets resumed
+// after a prompt changed says so instead of forgetting either one.
+func recordPrompts(story *Story, names ...string) {
+	if story.Prompts == nil {
+		story.Prompts = make(map[string]PromptVersion)
+	}
+	for _, name := range names {
+		version := prompts[name].version
+		previous, ok := story.Prompts[name]
+		if !ok {
+			story.Prompts[name] = version
+			continue
+		}
+		if changes := story.ChangedPrompts[name]; len(changes) > 0 {
+			previous = changes[len(changes)-1]
+		}
+		if previous.Hash == version.Hash {
+			continue
+		}
+		if story.ChangedPrompts == nil {
+			story.ChangedPrompts = make(map[string][]PromptVersion)
+		}
+		story.ChangedPrompts[name] = append(story.ChangedPrompts[name], version)
+		tell(fmt.Sprintf("The %s prompt changed since this story was started (%s, now %s), so the rest of it uses the new one.", name, previous.Version, version.Version))
+	}
+}
+
+// Notes down which versions of the named prompts something was just made
+// with, on top of the ones it was made with before. It's always a new map,
+// the old one could still be getting saved.
+func notePrompts(used map[string]PromptVersion, names ...string) map[string]PromptVersion {
+	noted := make(map[string]PromptVersion, len(used)+len(names))
+	for name, version := range used {
+		noted[name] = version
+	}
+	for _, name := range names {
+		noted[name] = prompts[name].version
+	}
+
+	return noted
+}
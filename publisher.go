@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Publish hands back where the finished story ended up (a file, a folder, a
+// URL) so it can be recorded in the manifest.
+type Publisher interface {
+	Name() string
+	Publish(ctx context.Context, story *Story) (string, error)
+}
+
+func getPublishers(names string) []Publisher {
+	publishers := make([]Publisher, 0)
+	for _, name := range strings.Split(names, ",") {
+		publishers = append(publishers, getPublisher(strings.TrimSpace(name)))
+	}
+
+	return publishers
+}
+
+func getPublisher(name string) Publisher {
+	switch strings.ToLower(name) {
+	case "slides":
+		return &SlidesPublisher{}
+	case "dryrun":
+		return &DryRunPublisher{}
+	case "pdf":
+		return &PDFPublisher{}
+	case "epub":
+		return &EPUBPublisher{}
+	case "site":
+		return &SitePublisher{}
+	}
+	panic(fmt.Sprintf("unknown publisher %q", name))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"github.com/sashabaranov/go-openai/jsonschema"
+	"sync"
+	"time"
+)
+
+// TokenBucket hands out requests at a steady rate, with a little room to
+// burst so the first few pages don't have to wait in line.
+type TokenBucket struct {
+	mutex     sync.Mutex
+	tokens    float64
+	capacity  float64
+	perSecond float64
+	last      time.Time
+}
+
+func newTokenBucket(perMinute int) *TokenBucket {
+	capacity := float64(perMinute / 10)
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &TokenBucket{
+		tokens:    capacity,
+		capacity:  capacity,
+		perSecond: float64(perMinute) / 60,
+		last:      time.Now(),
+	}
+}
+
+// Blocks until there's a token to spend or ctx is done.
+func (bucket *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		bucket.mutex.Lock()
+		now := time.Now()
+		bucket.tokens += now.Sub(bucket.last).Seconds() * bucket.perSecond
+		if bucket.tokens > bucket.capacity {
+			bucket.tokens = bucket.capacity
+		}
+		bucket.last = now
+		if bucket.tokens >= 1 {
+			bucket.tokens--
+			bucket.mutex.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - bucket.tokens) / bucket.perSecond * float64(time.Second))
+		bucket.mutex.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// The limited generators sit in front of the real ones, so every request to
+// a provider (the title, the cover, every page and every retry) comes out of
+// the same bucket.
+type RateLimitedTextGenerator struct {
+	Generator TextGenerator
+	Limiter   *TokenBucket
+}
+
+func (generator *RateLimitedTextGenerator) Generate(ctx context.Context, prompt string) (string, error) {
+	err := generator.Limiter.Wait(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return generator.Generator.Generate(ctx, prompt)
+}
+
+func (generator *RateLimitedTextGenerator) GenerateStructured(ctx context.Context, prompt string, name string, schema jsonschema.Definition) (string, error) {
+	structured, ok := generator.Generator.(StructuredTextGenerator)
+	if !ok {
+		return "", ErrStructuredUnsupported
+	}
+	err := generator.Limiter.Wait(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return structured.GenerateStructured(ctx, prompt, name, schema)
+}
+
+type RateLimitedImageGenerator struct {
+	Generator ImageGenerator
+	Limiter   *TokenBucket
+}
+
+func (generator *RateLimitedImageGenerator) GenerateImages(ctx context.Context, request ImageRequest) ([]GeneratedImage, error) {
+	err := generator.Limiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return generator.Generator.GenerateImages(ctx, request)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Audience is who a story is being written for. It decides how long the
+// story is, how much goes on a page, and how hard the words are allowed to
+// get.
+type Audience struct {
+	Name             string
+	Description      string
+	Instructions     string
+	Paragraphs       int
+	MaxWords         int
+	MaxSentenceWords int
+	MaxGrade         float64
+}
+
+var audiences = map[string]Audience{
+	"board-book": {
+		Name:             "board-book",
+		Description:      "toddlers ages 2 to 4 having it read to them",
+		Instructions:     "Use short, simple sentences, familiar everyday words, and a little repetition.",
+		Paragraphs:       6,
+		MaxWords:         25,
+		MaxSentenceWords: 10,
+		MaxGrade:         2,
+	},
+	"early-reader": {
+		Name:             "early-reader",
+		Description:      "children ages 5 to 7 who are starting to read on their own",
+		Instructions:     "Use simple sentences and words a beginning reader can sound out.",
+		Paragraphs:       8,
+		MaxWords:         60,
+		MaxSentenceWords: 14,
+		MaxGrade:         4,
+	},
+	"chapter-book": {
+		Name:             "chapter-book",
+		Description:      "children ages 8 to 10 who read confidently",
+		Instructions:     "Use varied sentences and a richer vocabulary, but keep it easy to follow.",
+		Paragraphs:       10,
+		MaxWords:         120,
+		MaxSentenceWords: 20,
+		MaxGrade:         6.5,
+	},
+}
+
+const defaultAudience = "early-reader"
+
+// Stories written before there were audiences don't have one, and they get
+// the default.
+func getAudience(name string) (Audience, bool) {
+	if name == "" {
+		name = defaultAudience
+	}
+	audience, ok := audiences[strings.ToLower(strings.TrimSpace(name))]
+
+	return audience, ok
+}
+
+func getAudienceNames() []string {
+	names := make([]string, 0, len(audiences))
+	for name := range audiences {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Readability is how a paragraph measured up against the story's audience,
+// kept in the manifest alongside the paragraphs.
+type Readability struct {
+	Words           int
+	Sentences       int
+	LongestSentence int
+	Grade           float64
+	Rewrites        int
+	Fits            bool
+}
+
+// Flesch-Kincaid grade level, plus the word and sentence counts that go into
+// it. Syllables are counted by vowel groups, which is close enough for the
+// kind of words in a children's book.
+func measureReadability(text string) Readability {
+	readability := Readability{}
+	syllables := 0
+	for _, sentence := range strings.FieldsFunc(text, isSentenceEnd) {
+		words := strings.FieldsFunc(sentence, isWordBreak)
+		if len(words) == 0 {
+			continue
+		}
+		readability.Sentences++
+		readability.Words += len(words)
+		if len(words) > readability.LongestSentence {
+			readability.LongestSentence = len(words)
+		}
+		for _, word := range words {
+			syllables += countSyllables(word)
+		}
+	}
+	if readability.Words == 0 {
+		return readability
+	}
+	readability.Grade = 0.39*float64(readability.Words)/float64(readability.Sentences) + 11.8*float64(syllables)/float64(readability.Words) - 15.59
+
+	return readability
+}
+
+func isSentenceEnd(r rune) bool {
+	return r == '.' || r == '!' || r == '?'
+}
+
+func isWordBreak(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+}
+
+func countSyllables(word string) int {
+	word = strings.ToLower(word)
+	count := 0
+	previousVowel := false
+	for _, r := range word {
+		vowel := strings.ContainsRune("aeiouy", r)
+		if vowel && !previousVowel {
+			count++
+		}
+		previousVowel = vowel
+	}
+	// The e at the end of "page" is silent, the one in "little" isn't
+	if strings.HasSuffix(word, "e") && !strings.HasSuffix(word, "le") && count > 1 {
+		count--
+	}
+	if count == 0 {
+		count = 1
+	}
+
+	return count
+}
+
+func (audience Audience) fits(readability Readability) bool {
+	return readability.Words <= audience.MaxWords &&
+		readability.LongestSentence <= audience.MaxSentenceWords &&
+		readability.Grade <= audience.MaxGrade
+}
+
+// How far over the band a paragraph is, so the better of two rewrites can
+// be kept when neither one quite makes it.
+func (audience Audience) overshoot(readability Readability) float64 {
+	over := 0.0
+	if readability.Words > audience.MaxWords {
+		over += float64(readability.Words-audience.MaxWords) / float64(audience.MaxWords)
+	}
+	if readability.LongestSentence > audience.MaxSentenceWords {
+		over += float64(readability.LongestSentence-audience.MaxSentenceWords) / float64(audience.MaxSentenceWords)
+	}
+	if readability.Grade > audience.MaxGrade {
+		over += (readability.Grade - audience.MaxGrade) / audience.MaxGrade
+	}
+
+	return over
+}
+
+// How many times a paragraph gets rewritten before we take the closest one.
+const readingLevelRewrites = 2
+
+// Measures the next paragraph that hasn't been checked yet and rewrites it if
+// it's too much for the audience. The paragraphs are done one at a time, in
+// order, so a story that stops partway picks up at the next one.
+func checkReadingLevel(ctx context.Context, story *Story, index int) error {
+	audience, _ := getAudience(story.Synopsis.Audience)
+	paragraph := story.Paragraphs[index]
+	readability := measureReadability(paragraph)
+	for readability.Rewrites < readingLevelRewrites && !audience.fits(readability) {
+		if readability.Rewrites == 0 {
+			say(fmt.Sprintf("Page %d is a bit much for %s. Let me simplify it...", index+1, audience.Description))
+		}
+		rewrite, err := rewriteParagraph(ctx, story.Synopsis, paragraph)
+		if err != nil {
+			return err
+		}
+		rewriteReadability := measureReadability(rewrite)
+		rewriteReadability.Rewrites = readability.Rewrites + 1
+		if audience.overshoot(rewriteReadability) <= audience.overshoot(readability) {
+			paragraph = rewrite
+			readability = rewriteReadability
+		} else {
+			readability.Rewrites++
+		}
+	}
+	readability.Fits = audience.fits(readability)
+	story.Paragraphs[index] = paragraph
+	story.Readability = append(story.Readability[:index], readability)
+
+	return nil
+}
+
+func rewriteParagraph(ctx context.Context, synopsis StorySynopsis, paragraph string) (string, error) {
+	data := getPromptData(synopsis)
+	data.Excerpt = paragraph
+	prompt, err := renderPrompt("rewrite", data)
+	if err != nil {
+		return "", err
+	}
+	resp, err := getGPTResponse(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+
+	// It has to stay one paragraph no matter how it came back
+	rewrite := strings.Join(strings.Fields(resp), " ")
+	rewrite = strings.Trim(rewrite, `"`)
+	if rewrite == "" {
+		return paragraph, nil
+	}
+
+	return rewrite, nil
+}
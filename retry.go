@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/api/googleapi"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy decides how many times, and how far apart, something gets
+// tried again. Waits grow exponentially from BaseDelay up to MaxDelay with
+// some jitter thrown in so a pile of pages doesn't come back all at once,
+// unless the server told us exactly how long to wait with Retry-After.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Retryable   func(err error) bool
+}
+
+// Used around every call that leaves the machine: the text and image
+// providers, S3 and Google Slides.
+var apiRetryPolicy = RetryPolicy{
+	MaxAttempts: 6,
+	BaseDelay:   time.Second,
+	MaxDelay:    time.Minute,
+	Retryable:   isTransient,
+}
+
+// Used around whole stages when the answer came back but wasn't any good,
+// like a title in the wrong format. Asking again is all there is to do.
+var answerRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Retryable:   isBadAnswer,
+}
+
+func (policy RetryPolicy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		hint := &retryAfterHint{}
+		err := fn(context.WithValue(ctx, retryAfterKey{}, hint))
+		if err == nil || attempt >= policy.MaxAttempts || ctx.Err() != nil || !policy.Retryable(err) {
+			return err
+		}
+
+		delay := policy.getDelay(attempt, hint.get())
+		recordRetry(ctx, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+func (policy RetryPolicy) getDelay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	if policy.BaseDelay <= 0 {
+		return 0
+	}
+	delay := policy.BaseDelay << uint(attempt-1)
+	if delay <= 0 || delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	// Anywhere from half to all of it
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Rate limits and servers having a bad day, but not us sending something
+// the server will never accept.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var imageErr *ImageGenerationError
+	if errors.As(err, &imageErr) {
+		return isRetryableStatus(imageErr.StatusCode)
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return isRetryableStatus(apiErr.HTTPStatusCode)
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return isRetryableStatus(requestErr.HTTPStatusCode)
+	}
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) {
+		return isRetryableStatus(googleErr.Code)
+	}
+	var awsErr awserr.RequestFailure
+	if errors.As(err, &awsErr) {
+		return isRetryableStatus(awsErr.StatusCode())
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func isBadAnswer(err error) bool {
+	return errors.Is(err, ErrTitleFormat) || errors.Is(err, ErrStoryFormat) || errors.Is(err, ErrImageFiltered)
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusRequestTimeout || status >= 500
+}
+
+// The API clients only hand back a status code when something goes wrong,
+// so the Retry-After header is picked up on the way through the transport
+// and left on the request's context for RetryPolicy.Do to find.
+type retryAfterKey struct{}
+
+type retryAfterHint struct {
+	nanoseconds int64
+}
+
+func (hint *retryAfterHint) get() time.Duration {
+	return time.Duration(atomic.LoadInt64(&hint.nanoseconds))
+}
+
+type retryAfterTransport struct {
+	Base http.RoundTripper
+}
+
+func (transport *retryAfterTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := transport.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	res, err := base.RoundTrip(r)
+	if err != nil {
+		return res, err
+	}
+	hint, ok := r.Context().Value(retryAfterKey{}).(*retryAfterHint)
+	if ok && isRetryableStatus(res.StatusCode) {
+		atomic.StoreInt64(&hint.nanoseconds, int64(parseRetryAfter(res.Header.Get("Retry-After"))))
+	}
+
+	return res, nil
+}
+
+// Retry-After is either a number of seconds or a date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
+
+// Every API client shares this so they all report Retry-After.
+var httpClient = &http.Client{Transport: &retryAfterTransport{}}
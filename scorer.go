@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// ImageScorer decides which of a page's candidate pictures goes in the book.
+// Higher is better, and ties go to whichever came back first.
+type ImageScorer interface {
+	ScoreImage(ctx context.Context, prompt string, imageBytes []byte) (float64, error)
+}
+
+// FirstImageScorer keeps whatever came back first, which is how it always
+// worked before there was more than one.
+type FirstImageScorer struct{}
+
+func (scorer *FirstImageScorer) ScoreImage(ctx context.Context, prompt string, imageBytes []byte) (float64, error) {
+	return 0, nil
+}
+
+// HeuristicImageScorer doesn't know what's in the picture, but the ones that
+// go wrong tend to be washed out, muddy or nearly blank. It likes contrast
+// and color, and a picture that's mostly one flat color scores nothing.
+type HeuristicImageScorer struct{}
+
+func (scorer *HeuristicImageScorer) ScoreImage(ctx context.Context, prompt string, imageBytes []byte) (float64, error) {
+	picture, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return 0, err
+	}
+	bounds := picture.Bounds()
+	// Every pixel is a lot of pixels, a grid of them is plenty
+	step := bounds.Dx() / 128
+	if step < 1 {
+		step = 1
+	}
+
+	var count, lumaSum, lumaSquares, rgSum, rgSquares, ybSum, ybSquares float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, _ := picture.At(x, y).RGBA()
+			red, green, blue := float64(r>>8), float64(g>>8), float64(b>>8)
+			luma := 0.299*red + 0.587*green + 0.114*blue
+			rg := red - green
+			yb := (red+green)/2 - blue
+			count++
+			lumaSum += luma
+			lumaSquares += luma * luma
+			rgSum += rg
+			rgSquares += rg * rg
+			ybSum += yb
+			ybSquares += yb * yb
+		}
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	deviation := func(sum float64, squares float64) float64 {
+		return math.Sqrt(math.Max(squares/count-(sum/count)*(sum/count), 0))
+	}
+	contrast := deviation(lumaSum, lumaSquares)
+	if contrast < 4 {
+		return 0, nil
+	}
+	// Hasler and Süsstrunk's colorfulness
+	rgDeviation, ybDeviation := deviation(rgSum, rgSquares), deviation(ybSum, ybSquares)
+	rgMean, ybMean := rgSum/count, ybSum/count
+	colorfulness := math.Sqrt(rgDeviation*rgDeviation+ybDeviation*ybDeviation) + 0.3*math.Sqrt(rgMean*rgMean+ybMean*ybMean)
+
+	return contrast/128 + colorfulness/100, nil
+}
+
+// ClipImageScorer asks a similarity service how well a picture matches its
+// prompt. It sends {"prompt": ..., "image": <base64>} and expects
+// {"score": ...} back, which is easy to put in front of CLIP or anything
+// like it.
+type ClipImageScorer struct {
+	URL string
+}
+
+type ClipScoreRequestBody struct {
+	Prompt string `json:"prompt"`
+	Image  string `json:"image"`
+}
+
+type ClipScoreResponseBody struct {
+	Score float64 `json:"score"`
+}
+
+func (scorer *ClipImageScorer) ScoreImage(ctx context.Context, prompt string, imageBytes []byte) (float64, error) {
+	postBody, _ := json.Marshal(ClipScoreRequestBody{
+		Prompt: prompt,
+		Image:  base64.StdEncoding.EncodeToString(imageBytes),
+	})
+	score := 0.0
+	err := apiRetryPolicy.Do(ctx, func(ctx context.Context) error {
+		r, _ := http.NewRequestWithContext(ctx, "POST", scorer.URL, bytes.NewBuffer(postBody))
+		r.Header.Add("content-type", "application/json")
+		res, err := httpClient.Do(r)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != 200 {
+			b, _ := io.ReadAll(res.Body)
+			return &ImageGenerationError{Provider: scorer.URL, StatusCode: res.StatusCode, Body: string(b)}
+		}
+		results := &ClipScoreResponseBody{}
+		err = json.NewDecoder(res.Body).Decode(results)
+		score = results.Score
+		return err
+	})
+
+	return score, err
+}
+
+func getImageScorer() ImageScorer {
+	switch IMAGE_SCORER {
+	case "heuristic":
+		return &HeuristicImageScorer{}
+	case "clip":
+		return &ClipImageScorer{URL: strings.TrimSpace(IMAGE_SCORER_URL)}
+	case "first":
+		return &FirstImageScorer{}
+	}
+	panic(fmt.Sprintf("unknown IMAGE_SCORER %q", IMAGE_SCORER))
+}
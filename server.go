@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Job struct {
+	Id         string
+	Status     string
+	Synopsis   StorySynopsis
+	Error      string `json:",omitempty"`
+	CreatedAt  time.Time
+	FinishedAt *time.Time `json:",omitempty"`
+}
+
+type JobPage struct {
+	Index     int
+	Paragraph string
+	Status    string
+	Image     string `json:",omitempty"`
+}
+
+type JobView struct {
+	Job
+	Stage          string
+	Title          string
+	RawGPTResponse string
+	Cover          string `json:",omitempty"`
+	Pages          []JobPage
+	Outputs        map[string]string
+	Artifacts      string
+}
+
+type Artifact struct {
+	Name string
+	URL  string
+	Size int64
+}
+
+// JobServer runs stories in the background and keeps track of them. What a
+// job has gotten through is read back off of its manifest, the same way
+// resume and list see it.
+type JobServer struct {
+	// Jobs outlive the request that started them, so they hang off of the
+	// server's context instead
+	ctx            context.Context
+	mutex          sync.Mutex
+	jobs           map[string]*Job
+	semaphore      chan struct{}
+	publisherNames []string
+}
+
+func serveCommand(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", ":8080", "the address to listen on")
+	concurrency := flags.Int("concurrency", 2, "how many stories to write at once")
+	publisherNames := flags.String("publishers", PUBLISHERS, "comma separated publishers to run for every story")
+	textProvider, imageProvider := addProviderFlags(flags)
+	parseFlags(flags, args)
+	applyProviderFlags(textProvider, imageProvider)
+	requireValidConfig(true, getPublisherNames(*publisherNames))
+	if *concurrency < 1 {
+		*concurrency = 1
+	}
+
+	printBanner()
+	setupProviders()
+	publishers = getPublishers(*publisherNames)
+	server := &JobServer{
+		ctx:       ctx,
+		jobs:      make(map[string]*Job),
+		semaphore: make(chan struct{}, *concurrency),
+	}
+	for _, publisher := range publishers {
+		server.publisherNames = append(server.publisherNames, publisher.Name())
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs", server.handleJobs)
+	mux.HandleFunc("/jobs/", server.handleJob)
+	httpServer := &http.Server{Addr: *addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+	fmt.Printf("Taking requests on %s\n", *addr)
+	err := httpServer.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		panic(err)
+	}
+	// Give the jobs that were running a chance to write down where they got to
+	for i := 0; i < cap(server.semaphore); i++ {
+		server.semaphore <- struct{}{}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(body)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"Error": message})
+}
+
+// /jobs
+func (server *JobServer) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		server.createJob(w, r)
+	case http.MethodGet:
+		server.mutex.Lock()
+		jobs := make([]Job, 0, len(server.jobs))
+		for _, job := range server.jobs {
+			jobs = append(jobs, *job)
+		}
+		server.mutex.Unlock()
+		sort.Slice(jobs, func(i, j int) bool {
+			return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+		})
+		writeJSON(w, http.StatusOK, jobs)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "use GET or POST")
+	}
+}
+
+// /jobs/{id}, /jobs/{id}/artifacts and /jobs/{id}/artifacts/{name}
+func (server *JobServer) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/"), "/")
+	id := parts[0]
+	if _, err := uuid.Parse(id); err != nil {
+		writeJSONError(w, http.StatusNotFound, "no job with that id")
+		return
+	}
+	job, story := server.getJob(id)
+	if job == nil {
+		writeJSONError(w, http.StatusNotFound, "no job with that id")
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		writeJSON(w, http.StatusOK, server.buildJobView(job, story))
+	case len(parts) == 2 && parts[1] == "artifacts":
+		writeJSON(w, http.StatusOK, listArtifacts(id))
+	case len(parts) >= 3 && parts[1] == "artifacts":
+		// Only ever serve things out of the story's own folder
+		name := filepath.Clean("/" + strings.Join(parts[2:], "/"))
+		http.ServeFile(w, r, filepath.Join(fmt.Sprintf("./images/%s", id), name))
+	default:
+		writeJSONError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (server *JobServer) createJob(w http.ResponseWriter, r *http.Request) {
+	synopsis := StorySynopsis{}
+	err := json.NewDecoder(r.Body).Decode(&synopsis)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "the body should be a JSON synopsis")
+		return
+	}
+	synopsis.Animal = strings.TrimSpace(synopsis.Animal)
+	synopsis.Name = strings.TrimSpace(synopsis.Name)
+	synopsis.Goal = strings.TrimSpace(synopsis.Goal)
+	if synopsis.Animal == "" || synopsis.Name == "" || synopsis.Goal == "" {
+		writeJSONError(w, http.StatusBadRequest, "Animal, Name and Goal are all required")
+		return
+	}
+	audience, ok := getAudience(synopsis.Audience)
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Audience should be one of %s", strings.Join(getAudienceNames(), ", ")))
+		return
+	}
+	synopsis.Audience = audience.Name
+	if !isArtStyle(synopsis.Style) {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Style should be one of %s", strings.Join(getArtStyleNames(), ", ")))
+		return
+	}
+	if synopsis.FromCover < 0 || synopsis.FromCover >= 1 {
+		writeJSONError(w, http.StatusBadRequest, "FromCover has to be at least 0 and less than 1")
+		return
+	}
+	if synopsis.Length < 0 {
+		writeJSONError(w, http.StatusBadRequest, "Length can't be negative")
+		return
+	}
+	synopsis.Negative = splitPromptList(strings.Join(synopsis.Negative, ","))
+
+	story := buildStory()
+	story.Synopsis = synopsis
+	saveManifest(story)
+	job := &Job{
+		Id:        story.Id.String(),
+		Status:    "queued",
+		Synopsis:  synopsis,
+		CreatedAt: time.Now(),
+	}
+	server.mutex.Lock()
+	server.jobs[job.Id] = job
+	server.mutex.Unlock()
+
+	// The job is the runner's to update from here on out
+	accepted := *job
+	go server.runJob(job, story)
+	w.Header().Set("Location", fmt.Sprintf("/jobs/%s", job.Id))
+	writeJSON(w, http.StatusAccepted, accepted)
+}
+
+func (server *JobServer) runJob(job *Job, story *Story) {
+	server.semaphore <- struct{}{}
+	defer func() { <-server.semaphore }()
+
+	server.setStatus(job, "running", nil)
+	if server.ctx.Err() != nil {
+		server.setStatus(job, "failed", server.ctx.Err())
+		return
+	}
+	err := runPipeline(server.ctx, story)
+	if err != nil {
+		reportFailure(story, err)
+		server.setStatus(job, "failed", err)
+		return
+	}
+	server.setStatus(job, "finished", nil)
+}
+
+func (server *JobServer) setStatus(job *Job, status string, err error) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	job.Status = status
+	if err != nil {
+		job.Error = err.Error()
+	}
+	if status == "finished" || status == "failed" {
+		now := time.Now()
+		job.FinishedAt = &now
+	}
+}
+
+// Jobs from before the server was restarted are still on disk, so those are
+// looked up from their manifest instead.
+func (server *JobServer) getJob(id string) (*Job, *Story) {
+	story, err := loadManifest(id)
+	if err != nil {
+		return nil, nil
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if job, ok := server.jobs[id]; ok {
+		copied := *job
+		return &copied, story
+	}
+	status := "finished"
+	if getIncompleteStage(story, server.publisherNames) != "" {
+		status = "interrupted"
+	}
+
+	return &Job{Id: id, Status: status, Synopsis: story.Synopsis}, story
+}
+
+func (server *JobServer) buildJobView(job *Job, story *Story) JobView {
+	view := JobView{
+		Job:            *job,
+		Stage:          getIncompleteStage(story, server.publisherNames),
+		RawGPTResponse: story.RawGPTResponse,
+		Pages:          make([]JobPage, 0, len(story.Paragraphs)),
+		Outputs:        story.Outputs,
+		Artifacts:      fmt.Sprintf("/jobs/%s/artifacts", job.Id),
+	}
+	if view.Stage == "" {
+		view.Stage = "done"
+	}
+	if story.Title != defaultTitle || story.TitleFailed {
+		view.Title = story.Title
+	}
+	if fileExists(story.CoverImagePath) {
+		view.Cover = fmt.Sprintf("/jobs/%s/artifacts/%s", job.Id, filepath.Base(story.CoverImagePath))
+	}
+	for index, paragraph := range story.Paragraphs {
+		page := JobPage{
+			Index:     index,
+			Paragraph: paragraph,
+			Status:    "pending",
+		}
+		if index < len(story.Pages) {
+			switch {
+			case pageIsComplete(&story.Pages[index]):
+				page.Status = "illustrated"
+				page.Image = fmt.Sprintf("/jobs/%s/artifacts/%s", job.Id, filepath.Base(story.Pages[index].ImagePath))
+			case story.Pages[index].ImageDescriptor != "":
+				page.Status = "described"
+			}
+		}
+		view.Pages = append(view.Pages, page)
+	}
+
+	return view
+}
+
+func listArtifacts(id string) []Artifact {
+	root := fmt.Sprintf("./images/%s", id)
+	artifacts := make([]Artifact, 0)
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+		name, _ := filepath.Rel(root, path)
+		name = filepath.ToSlash(name)
+		artifacts = append(artifacts, Artifact{
+			Name: name,
+			URL:  fmt.Sprintf("/jobs/%s/artifacts/%s", id, name),
+			Size: info.Size(),
+		})
+		return nil
+	})
+
+	return artifacts
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+)
+
+// SitePublisher writes the story out as a folder of plain HTML that can be
+// dropped on any static host. The pages are laid out like the slides: the
+// illustration fills the screen and the text sits in a see-through panel.
+type SitePublisher struct{}
+
+type sitePage struct {
+	FileName  string
+	Number    int
+	ImageName string
+	Text      string
+	Previous  string
+	Next      string
+}
+
+type siteData struct {
+	Title     string
+	Language  string
+	CoverName string
+	First     string
+	Pages     []sitePage
+	Page      sitePage
+}
+
+var siteLayout = `{{define "head"}}<!DOCTYPE html>
+<html lang="{{.Language}}">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>{{.Title}}</title>
+  <link rel="stylesheet" href="style.css">
+</head>
+{{end}}`
+
+var siteIndexTemplate = template.Must(template.New("index.html").Parse(siteLayout + `{{template "head" .}}
+<body data-next="{{.First}}">
+  <main class="slide">
+    <img class="illustration" src="images/{{.CoverName}}" alt="">
+    <div class="title">
+      <h1>{{.Title}}</h1>
+      <a class="start" href="{{.First}}">Start reading</a>
+    </div>
+  </main>
+  <nav class="contents">
+    <ol>
+      {{- range .Pages}}
+      <li><a href="{{.FileName}}">Page {{.Number}}</a></li>
+      {{- end}}
+    </ol>
+  </nav>
+  <script src="script.js"></script>
+</body>
+</html>
+`))
+
+var sitePageTemplate = template.Must(template.New("page.html").Parse(siteLayout + `{{template "head" .}}
+<body data-previous="{{.Page.Previous}}" data-next="{{.Page.Next}}">
+  <main class="slide">
+    <img class="illustration" src="images/{{.Page.ImageName}}" alt="">
+    <div class="paragraph"><p>{{.Page.Text}}</p></div>
+  </main>
+  <footer class="controls">
+    <a href="{{.Page.Previous}}">&larr;</a>
+    <span>{{.Page.Number}} / {{len .Pages}}</span>
+    <a href="{{.Page.Next}}">&rarr;</a>
+  </footer>
+  <script src="script.js"></script>
+</body>
+</html>
+`))
+
+var siteFinalTemplate = template.Must(template.New("final.html").Parse(siteLayout + `{{template "head" .}}
+<body data-previous="{{.Page.Previous}}" data-next="index.html">
+  <main class="slide final">
+    <p class="made-with">Made With</p>
+    <p class="storybook">Storybook</p>
+    <a class="button" href="https://github.com/MATTALUI/storybook">How It Works</a>
+    <a class="button" href="https://github.com/MATTALUI/storybook">Source</a>
+    <a class="button" href="https://github.com/MATTALUI/storybook">Version 0.1.0</a>
+  </main>
+  <script src="script.js"></script>
+</body>
+</html>
+`))
+
+var siteStyle = `html, body { margin: 0; height: 100%; background: #111; }
+.slide { position: relative; width: 100vw; height: 56.25vw; max-height: 100vh; max-width: 177.78vh; margin: auto; overflow: hidden; background: #fff; container-type: inline-size; }
+.illustration { position: absolute; inset: 0; width: 100%; height: 100%; object-fit: cover; }
+.title { position: absolute; inset: 0; display: flex; flex-direction: column; align-items: center; justify-content: center; background: rgba(94, 94, 94, 0.5); }
+.title h1 { margin: 0 5%; color: #fff; text-align: center; font-family: "Pacifico", cursive; font-size: 11cqw; }
+.start { margin-top: 2cqw; padding: 1cqw 3cqw; border-radius: 1cqw; background: rgba(237, 237, 237, 0.85); color: #000; text-decoration: none; font-family: "Changa One", sans-serif; font-size: 2cqw; }
+.paragraph { position: absolute; top: 3.7%; left: 2.08%; width: 37.36%; height: 88.89%; box-sizing: border-box; padding: 1cqw; background: rgba(94, 94, 94, 0.69); border: 1px solid #595959; overflow: auto; }
+.paragraph p { margin: 0; color: #fff; font-weight: bold; font-family: Arial, sans-serif; font-size: 1.8cqw; line-height: 1.3; }
+.final { padding: 3cqw 3.3cqw; box-sizing: border-box; }
+.made-with { margin: 0; font-family: "Changa One", sans-serif; font-size: 2.6cqw; }
+.storybook { margin: 0 0 2cqw 0; font-family: "Pacifico", cursive; font-weight: bold; font-size: 11cqw; line-height: 1.2; }
+.button { display: block; width: 31cqw; margin-bottom: 1.3cqw; padding: 1.3cqw 0; border-radius: 1cqw; background: rgba(237, 237, 237, 0.85); color: #000; text-align: center; text-decoration: none; font-family: "Changa One", sans-serif; font-size: 1.9cqw; }
+.controls, .contents { display: flex; justify-content: center; gap: 2em; padding: 1em; color: #ddd; font-family: "Changa One", sans-serif; }
+.controls a, .contents a { color: #ddd; text-decoration: none; }
+.contents ol { display: flex; flex-wrap: wrap; gap: 1em; list-style: none; padding: 0; }
+`
+
+var siteScript = `(function () {
+  var previous = document.body.dataset.previous;
+  var next = document.body.dataset.next;
+  var go = function (href) { if (href) { window.location.href = href; } };
+
+  document.addEventListener("keydown", function (event) {
+    if (event.key === "ArrowRight" || event.key === "PageDown" || event.key === " ") { go(next); }
+    if (event.key === "ArrowLeft" || event.key === "PageUp") { go(previous); }
+    if (event.key === "Home") { go("index.html"); }
+  });
+
+  var startX = null;
+  document.addEventListener("touchstart", function (event) {
+    startX = event.changedTouches[0].clientX;
+  }, { passive: true });
+  document.addEventListener("touchend", function (event) {
+    if (startX === null) { return; }
+    var distance = event.changedTouches[0].clientX - startX;
+    startX = null;
+    if (Math.abs(distance) < 50) { return; }
+    go(distance < 0 ? next : previous);
+  });
+})();
+`
+
+func (publisher *SitePublisher) Name() string {
+	return "site"
+}
+
+func (publisher *SitePublisher) Publish(ctx context.Context, story *Story) (string, error) {
+	say("Let me put this up on the web...")
+	siteDir := fmt.Sprintf("./images/%s/site", story.Id)
+	err := os.MkdirAll(filepath.Join(siteDir, "images"), os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+
+	coverPath := story.CoverImagePath
+	if coverPath == "" {
+		coverPath = fmt.Sprintf("./images/%s/cover.png", story.Id)
+	}
+	data := siteData{
+		Title:     story.Title,
+		Language:  EPUB_LANGUAGE,
+		CoverName: "cover.png",
+		First:     "final.html",
+		Pages:     make([]sitePage, 0, len(story.Pages)),
+	}
+	for index, page := range story.Pages {
+		entry := sitePage{
+			FileName:  fmt.Sprintf("page-%d.html", index+1),
+			Number:    index + 1,
+			ImageName: fmt.Sprintf("page-%d.png", index+1),
+			Text:      page.Paragraph,
+			Previous:  fmt.Sprintf("page-%d.html", index),
+			Next:      fmt.Sprintf("page-%d.html", index+2),
+		}
+		if index == 0 {
+			entry.Previous = "index.html"
+		}
+		if index == len(story.Pages)-1 {
+			entry.Next = "final.html"
+		}
+		data.Pages = append(data.Pages, entry)
+	}
+	if len(data.Pages) > 0 {
+		data.First = data.Pages[0].FileName
+	}
+
+	err = copyFile(coverPath, filepath.Join(siteDir, "images", data.CoverName))
+	if err != nil {
+		return "", err
+	}
+	err = writeSiteTemplate(filepath.Join(siteDir, "index.html"), siteIndexTemplate, data)
+	if err != nil {
+		return "", err
+	}
+	for index, page := range data.Pages {
+		err = copyFile(story.Pages[index].ImagePath, filepath.Join(siteDir, "images", page.ImageName))
+		if err != nil {
+			return "", err
+		}
+		data.Page = page
+		err = writeSiteTemplate(filepath.Join(siteDir, page.FileName), sitePageTemplate, data)
+		if err != nil {
+			return "", err
+		}
+	}
+	data.Page = sitePage{Previous: "index.html"}
+	if len(data.Pages) > 0 {
+		data.Page.Previous = data.Pages[len(data.Pages)-1].FileName
+	}
+	err = writeSiteTemplate(filepath.Join(siteDir, "final.html"), siteFinalTemplate, data)
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(filepath.Join(siteDir, "style.css"), []byte(siteStyle), 0644)
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(filepath.Join(siteDir, "script.js"), []byte(siteScript), 0644)
+	if err != nil {
+		return "", err
+	}
+	tell(fmt.Sprintf("Your book is online-ready in %s", siteDir))
+
+	return fmt.Sprintf("%s/index.html", siteDir), nil
+}
+
+func writeSiteTemplate(filePath string, tmpl *template.Template, data siteData) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return tmpl.Execute(f, data)
+}
+
+func copyFile(source string, destination string) error {
+	contents, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(destination, contents, 0644)
+}
@@ -0,0 +1,816 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/api/slides/v1"
+	"net/http"
+	"os"
+)
+
+func getTokenFromWeb(config *oauth2.Config) (*oauth2.Token, error) {
+	// Nobody's there to paste the code in when it's running in the
+	// background or under serve
+	if !isTerminal(os.Stdin) {
+		return nil, fmt.Errorf("there's no token.json yet, run storybook from a terminal once to sign in to Google")
+	}
+	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
+	fmt.Printf("Go to the following link in your browser then type the "+
+		"authorization code: \n%v\n", authURL)
+
+	var authCode string
+	if _, err := fmt.Scan(&authCode); err != nil {
+		return nil, fmt.Errorf("unable to read authorization code: %w", err)
+	}
+
+	tok, err := config.Exchange(oauth2.NoContext, authCode)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve token from web: %w", err)
+	}
+
+	return tok, nil
+}
+
+func tokenFromFile(file string) (*oauth2.Token, error) {
+	f, err := os.Open(file)
+	defer f.Close()
+	if err != nil {
+		return nil, err
+	}
+	tok := &oauth2.Token{}
+	err = json.NewDecoder(f).Decode(tok)
+
+	return tok, err
+}
+
+func saveToken(path string, token *oauth2.Token) {
+	fmt.Printf("Saving credential file to: %s\n", path)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	defer f.Close()
+	if err != nil {
+		fmt.Println("Unable to cache OAuth token")
+	}
+	json.NewEncoder(f).Encode(token)
+}
+
+func getGoogleClient(ctx context.Context) (*http.Client, error) {
+	credsBytes, err := os.ReadFile("./credentials.json")
+	if err != nil {
+		return nil, err
+	}
+	config, err := google.ConfigFromJSON(credsBytes, "https://www.googleapis.com/auth/documents", "https://www.googleapis.com/auth/presentations", "https://www.googleapis.com/auth/spreadsheets")
+	if err != nil {
+		return nil, fmt.Errorf("credentials.json: %w", err)
+	}
+	tokFile := "token.json"
+	tok, err := tokenFromFile(tokFile)
+	if err != nil {
+		tok, err = getTokenFromWeb(config)
+		if err != nil {
+			return nil, err
+		}
+		saveToken(tokFile, tok)
+	}
+	client := config.Client(ctx, tok)
+	client.Transport = &retryAfterTransport{Base: client.Transport}
+
+	return client, nil
+}
+
+type SlidesPublisher struct{}
+
+func (publisher *SlidesPublisher) Name() string {
+	return "slides"
+}
+
+func (publisher *SlidesPublisher) Publish(ctx context.Context, story *Story) (string, error) {
+	say("Ah! That's perfect! Let me just put the finishing touches on it...")
+	err := uploadPublicImages(ctx, story)
+	saveManifest(story)
+	if err != nil {
+		return "", err
+	}
+	client, err := getGoogleClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	slidesService, err := slides.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return "", err
+	}
+
+	// Creating a deck isn't something that can safely be tried twice, a
+	// timeout could mean there's one out there already. So it's only tried
+	// once, and a deck that never got filled in is kept for next time.
+	if story.PendingPresentationId == "" {
+		presentation := &slides.Presentation{}
+		presentation.Title = story.Title
+		presentation.Layouts = []*slides.Page{
+			{
+				PageType: "LAYOUT",
+			},
+		}
+		presentation, err = slidesService.Presentations.Create(presentation).Context(ctx).Do()
+		if err != nil {
+			return "", err
+		}
+		story.PendingPresentationId = presentation.PresentationId
+		saveManifest(story)
+	}
+	presentationId := story.PendingPresentationId
+	updates := slides.BatchUpdatePresentationRequest{}
+	updates.Requests = buildSlideRequests(story)
+
+	// A batch update is all or nothing, so a failed one leaves the deck empty
+	err = apiRetryPolicy.Do(ctx, func(ctx context.Context) error {
+		_, err := slidesService.Presentations.BatchUpdate(presentationId, &updates).Context(ctx).Do()
+		return err
+	})
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) && googleErr.Code == http.StatusNotFound {
+		// Somebody threw the empty deck away
+		story.PendingPresentationId = ""
+	}
+	if err != nil {
+		return "", err
+	}
+	story.PendingPresentationId = ""
+
+	return fmt.Sprintf("https://docs.google.com/presentation/d/%s/edit", presentationId), nil
+}
+
+// DryRunPublisher writes out the requests the SlidesPublisher would have sent
+// so a deck can be looked over before it's created.
+type DryRunPublisher struct{}
+
+func (publisher *DryRunPublisher) Name() string {
+	return "dryrun"
+}
+
+func (publisher *DryRunPublisher) Publish(ctx context.Context, story *Story) (string, error) {
+	os.MkdirAll(fmt.Sprintf("./images/%s", story.Id), os.ModePerm)
+	filePath := fmt.Sprintf("./images/%s/slides.json", story.Id)
+	f, err := os.Create(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(buildSlideRequests(story))
+	if err != nil {
+		return "", err
+	}
+	tell(fmt.Sprintf("I wrote down what the slides would look like in %s", filePath))
+
+	return filePath, nil
+}
+
+func buildSlideRequests(story *Story) []*slides.Request {
+	requests := make([]*slides.Request, 0)
+	requests = append(requests, buildTitleSlideUpdates(story)...)
+	for index := range story.Pages {
+		requests = append(requests, buildPageSlideUpdates(index, &story.Pages[index])...)
+	}
+	requests = append(requests, getFinalSlide()...)
+
+	return requests
+}
+
+func buildTitleSlideUpdates(story *Story) []*slides.Request {
+	// ctx := context.Background()
+	// client := getGoogleClient()
+	// slidesService, _ := slides.NewService(ctx, option.WithHTTPClient(client))
+
+	// presentation := &slides.Presentation{}
+	// presentation.Title = "Storybook Final Slide test"
+	// presentation.Layouts = []*slides.Page{
+	// 	{
+	// 		PageType: "LAYOUT",
+	// 	},
+	// }
+	// presentation, _ = slidesService.Presentations.Create(presentation).Do()
+	// Without a cover the title slide gets the final slide's picture
+	coverUrl := story.CoverPublicImagePath
+	if coverUrl == "" {
+		coverUrl = FINAL_SLIDE_IMAGE
+	}
+	updates := slides.BatchUpdatePresentationRequest{}
+	updates.Requests = []*slides.Request{
+		{
+			CreateSlide: &slides.CreateSlideRequest{
+				ObjectId: "titleSlide",
+				SlideLayoutReference: &slides.LayoutReference{
+					PredefinedLayout: "BLANK",
+				},
+			},
+		},
+		{
+			DeleteObject: &slides.DeleteObjectRequest{
+				ObjectId: "p", // this is the title given to the default slide
+			},
+		},
+		{
+			CreateImage: &slides.CreateImageRequest{
+				ObjectId: "titlecoverimage",
+				Url:      coverUrl,
+				ElementProperties: &slides.PageElementProperties{
+					PageObjectId: "titleSlide",
+					Transform: &slides.AffineTransform{
+						ScaleX:     1.05,
+						ScaleY:     1.05,
+						TranslateX: 0.0,
+						TranslateY: 0.0,
+						Unit:       "PT",
+					},
+				},
+			},
+		},
+		{
+			CreateShape: &slides.CreateShapeRequest{
+				ObjectId:  "titlebackground",
+				ShapeType: "TEXT_BOX",
+				ElementProperties: &slides.PageElementProperties{
+					PageObjectId: "titleSlide",
+					Size: &slides.Size{
+						Width:  &slides.Dimension{Magnitude: 720, Unit: "PT"},
+						Height: &slides.Dimension{Magnitude: 405.64, Unit: "PT"},
+					},
+					// Transform: &slides.AffineTransform{
+					// 	ScaleX:     1.0,
+					// 	ScaleY:     1.0,
+					// 	TranslateX: 15.0,
+					// 	TranslateY: 15.0,
+					// 	Unit:       "PT",
+					// },
+				},
+			},
+		},
+		{
+			UpdateShapeProperties: &slides.UpdateShapePropertiesRequest{
+				ObjectId: "titlebackground",
+				Fields:   "shapeBackgroundFill,outline,contentAlignment",
+				ShapeProperties: &slides.ShapeProperties{
+					ContentAlignment: "Middle",
+					// Outline: &slides.Outline{
+					// 	Weight:    &slides.Dimension{Magnitude: 1, Unit: "PT"},
+					// 	DashStyle: "SOLID",
+					// 	OutlineFill: &slides.OutlineFill{
+					// 		SolidFill: &slides.SolidFill{
+					// 			Color: &slides.OpaqueColor{
+					// 				RgbColor: &slides.RgbColor{
+					// 					Red:   0.35,
+					// 					Green: 0.35,
+					// 					Blue:  0.35,
+					// 				},
+					// 			},
+					// 		},
+					// 	},
+					// },
+					ShapeBackgroundFill: &slides.ShapeBackgroundFill{
+						SolidFill: &slides.SolidFill{
+							Alpha: 0.5,
+							Color: &slides.OpaqueColor{
+								RgbColor: &slides.RgbColor{
+									Red:   0.37,
+									Green: 0.37,
+									Blue:  0.37,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			InsertText: &slides.InsertTextRequest{
+				ObjectId: "titlebackground",
+				Text:     story.Title,
+			},
+		},
+		{
+			UpdateParagraphStyle: &slides.UpdateParagraphStyleRequest{
+				ObjectId: "titlebackground",
+				Fields:   "alignment",
+				Style: &slides.ParagraphStyle{
+					Alignment: "Center",
+				},
+			},
+		},
+		{
+			UpdateTextStyle: &slides.UpdateTextStyleRequest{
+				ObjectId: "titlebackground",
+				Fields:   "bold,fontSize,foregroundColor,fontFamily",
+				Style: &slides.TextStyle{
+					Bold:       true,
+					FontSize:   &slides.Dimension{Magnitude: 80, Unit: "PT"},
+					FontFamily: "Pacifico",
+					ForegroundColor: &slides.OptionalColor{
+						OpaqueColor: &slides.OpaqueColor{
+							RgbColor: &slides.RgbColor{
+								Red:   1.0,
+								Green: 1.0,
+								Blue:  1.0,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// _, err := slidesService.Presentations.BatchUpdate(presentation.PresentationId, &updates).Do()
+	// if err != nil {
+	// 	panic(err)
+	// }
+
+	return updates.Requests
+}
+
+func buildPageSlideUpdates(index int, page *Page) []*slides.Request {
+	slideId := fmt.Sprintf("%d_SLIDE", index)
+	paragraphId := fmt.Sprintf("%d_PARAGRAPH", index)
+	imageId := fmt.Sprintf("%d_IMAGE", index)
+
+	return []*slides.Request{
+		{
+			CreateSlide: &slides.CreateSlideRequest{
+				ObjectId: slideId,
+				SlideLayoutReference: &slides.LayoutReference{
+					PredefinedLayout: "BLANK",
+				},
+			},
+		},
+		{
+			CreateImage: &slides.CreateImageRequest{
+				ObjectId: imageId,
+				Url:      page.PublicImagePath,
+				ElementProperties: &slides.PageElementProperties{
+					PageObjectId: slideId,
+					Transform: &slides.AffineTransform{
+						ScaleX:     1.05,
+						ScaleY:     1.05,
+						TranslateX: 0.0,
+						TranslateY: 0.0,
+						Unit:       "PT",
+					},
+				},
+			},
+		},
+		{
+			CreateShape: &slides.CreateShapeRequest{
+				ObjectId:  paragraphId,
+				ShapeType: "TEXT_BOX",
+				ElementProperties: &slides.PageElementProperties{
+					PageObjectId: slideId,
+					Size: &slides.Size{
+						Width:  &slides.Dimension{Magnitude: 269, Unit: "PT"},
+						Height: &slides.Dimension{Magnitude: 360, Unit: "PT"},
+					},
+					Transform: &slides.AffineTransform{
+						ScaleX:     1.0,
+						ScaleY:     1.0,
+						TranslateX: 15.0,
+						TranslateY: 15.0,
+						Unit:       "PT",
+					},
+				},
+			},
+		},
+		{
+			UpdateShapeProperties: &slides.UpdateShapePropertiesRequest{
+				ObjectId: paragraphId,
+				Fields:   "shapeBackgroundFill,outline,contentAlignment",
+				ShapeProperties: &slides.ShapeProperties{
+					ContentAlignment: "TOP",
+					Outline: &slides.Outline{
+						Weight:    &slides.Dimension{Magnitude: 1, Unit: "PT"},
+						DashStyle: "SOLID",
+						OutlineFill: &slides.OutlineFill{
+							SolidFill: &slides.SolidFill{
+								Color: &slides.OpaqueColor{
+									RgbColor: &slides.RgbColor{
+										Red:   0.35,
+										Green: 0.35,
+										Blue:  0.35,
+									},
+								},
+							},
+						},
+					},
+					ShapeBackgroundFill: &slides.ShapeBackgroundFill{
+						SolidFill: &slides.SolidFill{
+							Alpha: 0.69,
+							Color: &slides.OpaqueColor{
+								RgbColor: &slides.RgbColor{
+									Red:   0.37,
+									Green: 0.37,
+									Blue:  0.37,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			InsertText: &slides.InsertTextRequest{
+				ObjectId: paragraphId,
+				Text:     page.Paragraph,
+			},
+		},
+		{
+			UpdateParagraphStyle: &slides.UpdateParagraphStyleRequest{
+				ObjectId: paragraphId,
+				Fields:   "alignment",
+				Style: &slides.ParagraphStyle{
+					Alignment: "Start",
+				},
+			},
+		},
+		{
+			UpdateTextStyle: &slides.UpdateTextStyleRequest{
+				ObjectId: paragraphId,
+				Fields:   "bold,fontSize,foregroundColor",
+				Style: &slides.TextStyle{
+					Bold:     true,
+					FontSize: &slides.Dimension{Magnitude: 13, Unit: "PT"},
+					ForegroundColor: &slides.OptionalColor{
+						OpaqueColor: &slides.OpaqueColor{
+							RgbColor: &slides.RgbColor{
+								Red:   1.0,
+								Green: 1.0,
+								Blue:  1.0,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func getFinalSlide() []*slides.Request {
+	// ctx := context.Background()
+	// client := getGoogleClient()
+	// slidesService, _ := slides.NewService(ctx, option.WithHTTPClient(client))
+
+	// presentation := &slides.Presentation{}
+	// presentation.Title = "Storybook Final Slide test"
+	// presentation.Layouts = []*slides.Page{
+	// 	{
+	// 		PageType: "LAYOUT",
+	// 	},
+	// }
+	// presentation, _ = slidesService.Presentations.Create(presentation).Do()
+	updates := slides.BatchUpdatePresentationRequest{}
+	updates.Requests = []*slides.Request{
+		{
+			CreateSlide: &slides.CreateSlideRequest{
+				ObjectId:       "finalSlide",
+				InsertionIndex: 0,
+				SlideLayoutReference: &slides.LayoutReference{
+					PredefinedLayout: "BLANK",
+				},
+			},
+		},
+		{
+			CreateImage: &slides.CreateImageRequest{
+				ObjectId: "finalImage",
+				Url:      FINAL_SLIDE_IMAGE,
+				ElementProperties: &slides.PageElementProperties{
+					PageObjectId: "finalSlide",
+					Transform: &slides.AffineTransform{
+						ScaleX:     1.05,
+						ScaleY:     1.05,
+						TranslateX: 0.0,
+						TranslateY: 0.0,
+						Unit:       "PT",
+					},
+				},
+			},
+		},
+		// I want this image to be transparent but its a readonly property in
+		// the API. WTF?!
+		// {
+		// 	UpdateImageProperties: &slides.UpdateImagePropertiesRequest{
+		// 		ObjectId: "finalImage",
+		// 		Fields:   "transparency",
+		// 		ImageProperties: &slides.ImageProperties{
+		// 			Transparency: 0.69,
+		// 		},
+		// 	},
+		// },
+		{
+			CreateShape: &slides.CreateShapeRequest{
+				ObjectId:  "madeWith",
+				ShapeType: "TEXT_BOX",
+				ElementProperties: &slides.PageElementProperties{
+					PageObjectId: "finalSlide",
+					Size: &slides.Size{
+						Width:  &slides.Dimension{Magnitude: 163.44, Unit: "PT"},
+						Height: &slides.Dimension{Magnitude: 38.16, Unit: "PT"},
+					},
+					Transform: &slides.AffineTransform{
+						ScaleX:     1.0,
+						ScaleY:     1.0,
+						TranslateX: 23.75,
+						TranslateY: 20.88,
+						Unit:       "PT",
+					},
+				},
+			},
+		},
+		{
+			InsertText: &slides.InsertTextRequest{
+				ObjectId: "madeWith",
+				Text:     "Made With",
+			},
+		},
+		{
+			UpdateParagraphStyle: &slides.UpdateParagraphStyleRequest{
+				ObjectId: "madeWith",
+				Fields:   "alignment",
+				Style: &slides.ParagraphStyle{
+					Alignment: "Start",
+				},
+			},
+		},
+		{
+			UpdateTextStyle: &slides.UpdateTextStyleRequest{
+				ObjectId: "madeWith",
+				Fields:   "bold,fontSize,fontFamily",
+				Style: &slides.TextStyle{
+					Bold:       false,
+					FontSize:   &slides.Dimension{Magnitude: 19, Unit: "PT"},
+					FontFamily: "Changa One",
+				},
+			},
+		},
+		{
+			CreateShape: &slides.CreateShapeRequest{
+				ObjectId:  "storyBook",
+				ShapeType: "TEXT_BOX",
+				ElementProperties: &slides.PageElementProperties{
+					PageObjectId: "finalSlide",
+					Size: &slides.Size{
+						Width:  &slides.Dimension{Magnitude: 543.6, Unit: "PT"},
+						Height: &slides.Dimension{Magnitude: 130.32, Unit: "PT"},
+					},
+					Transform: &slides.AffineTransform{
+						ScaleX:     1.0,
+						ScaleY:     1.0,
+						TranslateX: 0.0,
+						TranslateY: 41.01,
+						Unit:       "PT",
+					},
+				},
+			},
+		},
+		{
+			InsertText: &slides.InsertTextRequest{
+				ObjectId: "storyBook",
+				Text:     "Storybook",
+			},
+		},
+		{
+			UpdateParagraphStyle: &slides.UpdateParagraphStyleRequest{
+				ObjectId: "storyBook",
+				Fields:   "alignment",
+				Style: &slides.ParagraphStyle{
+					Alignment: "Start",
+				},
+			},
+		},
+		{
+			UpdateTextStyle: &slides.UpdateTextStyleRequest{
+				ObjectId: "storyBook",
+				Fields:   "bold,fontSize,fontFamily",
+				Style: &slides.TextStyle{
+					Bold:       true,
+					FontSize:   &slides.Dimension{Magnitude: 80, Unit: "PT"},
+					FontFamily: "Pacifico",
+				},
+			},
+		},
+		{
+			CreateShape: &slides.CreateShapeRequest{
+				ObjectId:  "howitworks",
+				ShapeType: "ROUND_RECTANGLE",
+				ElementProperties: &slides.PageElementProperties{
+					PageObjectId: "finalSlide",
+					Size: &slides.Size{
+						Width:  &slides.Dimension{Magnitude: 223.2, Unit: "PT"},
+						Height: &slides.Dimension{Magnitude: 44.64, Unit: "PT"},
+					},
+					Transform: &slides.AffineTransform{
+						ScaleX:     1.0,
+						ScaleY:     1.0,
+						TranslateX: 23.76,
+						TranslateY: 171.36,
+						Unit:       "PT",
+					},
+				},
+			},
+		},
+		{
+			UpdateShapeProperties: &slides.UpdateShapePropertiesRequest{
+				ObjectId: "howitworks",
+				Fields:   "shapeBackgroundFill,link",
+				ShapeProperties: &slides.ShapeProperties{
+					Link: &slides.Link{
+						Url: "https://github.com/MATTALUI/storybook",
+					},
+					ShapeBackgroundFill: &slides.ShapeBackgroundFill{
+						SolidFill: &slides.SolidFill{
+							Alpha: 0.85,
+							Color: &slides.OpaqueColor{
+								RgbColor: &slides.RgbColor{
+									Red:   0.93,
+									Green: 0.93,
+									Blue:  0.93,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			InsertText: &slides.InsertTextRequest{
+				ObjectId: "howitworks",
+				Text:     "How It Works",
+			},
+		},
+		{
+			UpdateParagraphStyle: &slides.UpdateParagraphStyleRequest{
+				ObjectId: "howitworks",
+				Fields:   "alignment",
+				Style: &slides.ParagraphStyle{
+					Alignment: "Center",
+				},
+			},
+		},
+		{
+			UpdateTextStyle: &slides.UpdateTextStyleRequest{
+				ObjectId: "howitworks",
+				Fields:   "bold,fontSize,fontFamily",
+				Style: &slides.TextStyle{
+					Bold:       false,
+					FontSize:   &slides.Dimension{Magnitude: 14, Unit: "PT"},
+					FontFamily: "Changa One",
+				},
+			},
+		},
+		{
+			CreateShape: &slides.CreateShapeRequest{
+				ObjectId:  "sourcelink",
+				ShapeType: "ROUND_RECTANGLE",
+				ElementProperties: &slides.PageElementProperties{
+					PageObjectId: "finalSlide",
+					Size: &slides.Size{
+						Width:  &slides.Dimension{Magnitude: 223.2, Unit: "PT"},
+						Height: &slides.Dimension{Magnitude: 44.64, Unit: "PT"},
+					},
+					Transform: &slides.AffineTransform{
+						ScaleX:     1.0,
+						ScaleY:     1.0,
+						TranslateX: 23.76,
+						TranslateY: 225.36,
+						Unit:       "PT",
+					},
+				},
+			},
+		},
+		{
+			UpdateShapeProperties: &slides.UpdateShapePropertiesRequest{
+				ObjectId: "sourcelink",
+				Fields:   "shapeBackgroundFill,link",
+				ShapeProperties: &slides.ShapeProperties{
+					Link: &slides.Link{
+						Url: "https://github.com/MATTALUI/storybook",
+					},
+					ShapeBackgroundFill: &slides.ShapeBackgroundFill{
+						SolidFill: &slides.SolidFill{
+							Alpha: 0.85,
+							Color: &slides.OpaqueColor{
+								RgbColor: &slides.RgbColor{
+									Red:   0.93,
+									Green: 0.93,
+									Blue:  0.93,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			InsertText: &slides.InsertTextRequest{
+				ObjectId: "sourcelink",
+				Text:     "Source",
+			},
+		},
+		{
+			UpdateParagraphStyle: &slides.UpdateParagraphStyleRequest{
+				ObjectId: "sourcelink",
+				Fields:   "alignment",
+				Style: &slides.ParagraphStyle{
+					Alignment: "Center",
+				},
+			},
+		},
+		{
+			UpdateTextStyle: &slides.UpdateTextStyleRequest{
+				ObjectId: "sourcelink",
+				Fields:   "bold,fontSize,fontFamily",
+				Style: &slides.TextStyle{
+					Bold:       false,
+					FontSize:   &slides.Dimension{Magnitude: 14, Unit: "PT"},
+					FontFamily: "Changa One",
+				},
+			},
+		},
+		{
+			CreateShape: &slides.CreateShapeRequest{
+				ObjectId:  "versionlink",
+				ShapeType: "ROUND_RECTANGLE",
+				ElementProperties: &slides.PageElementProperties{
+					PageObjectId: "finalSlide",
+					Size: &slides.Size{
+						Width:  &slides.Dimension{Magnitude: 223.2, Unit: "PT"},
+						Height: &slides.Dimension{Magnitude: 44.64, Unit: "PT"},
+					},
+					Transform: &slides.AffineTransform{
+						ScaleX:     1.0,
+						ScaleY:     1.0,
+						TranslateX: 23.76,
+						TranslateY: 279.36,
+						Unit:       "PT",
+					},
+				},
+			},
+		},
+		{
+			UpdateShapeProperties: &slides.UpdateShapePropertiesRequest{
+				ObjectId: "versionlink",
+				Fields:   "shapeBackgroundFill,link",
+				ShapeProperties: &slides.ShapeProperties{
+					Link: &slides.Link{
+						Url: "https://github.com/MATTALUI/storybook",
+					},
+					ShapeBackgroundFill: &slides.ShapeBackgroundFill{
+						SolidFill: &slides.SolidFill{
+							Alpha: 0.85,
+							Color: &slides.OpaqueColor{
+								RgbColor: &slides.RgbColor{
+									Red:   0.93,
+									Green: 0.93,
+									Blue:  0.93,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			InsertText: &slides.InsertTextRequest{
+				ObjectId: "versionlink",
+				Text:     "Version 0.1.0",
+			},
+		},
+		{
+			UpdateParagraphStyle: &slides.UpdateParagraphStyleRequest{
+				ObjectId: "versionlink",
+				Fields:   "alignment",
+				Style: &slides.ParagraphStyle{
+					Alignment: "Center",
+				},
+			},
+		},
+		{
+			UpdateTextStyle: &slides.UpdateTextStyleRequest{
+				ObjectId: "versionlink",
+				Fields:   "bold,fontSize,fontFamily",
+				Style: &slides.TextStyle{
+					Bold:       false,
+					FontSize:   &slides.Dimension{Magnitude: 14, Unit: "PT"},
+					FontFamily: "Changa One",
+				},
+			},
+		},
+	}
+	// _, err := slidesService.Presentations.BatchUpdate(presentation.PresentationId, &updates).Do()
+	// if err != nil {
+	// 	panic(err)
+	// }
+
+	return updates.Requests
+}
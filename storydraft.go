@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sashabaranov/go-openai/jsonschema"
+	"regexp"
+	"strings"
+)
+
+// StoryDraft is the story the way it's asked for when the text provider can
+// answer in JSON: already split into pages, with a title and an idea for
+// every illustration.
+type StoryDraft struct {
+	Title string           `json:"title"`
+	Pages []StoryDraftPage `json:"pages"`
+	Moral string           `json:"moral"`
+}
+
+type StoryDraftPage struct {
+	Text         string `json:"text"`
+	Illustration string `json:"illustration"`
+}
+
+var storyDraftSchema = jsonschema.Definition{
+	Type: jsonschema.Object,
+	Properties: map[string]jsonschema.Definition{
+		"title": {
+			Type:        jsonschema.String,
+			Description: "The title of the story, without a subtitle",
+		},
+		"pages": {
+			Type:        jsonschema.Array,
+			Description: "The story one page at a time, in order",
+			Items: &jsonschema.Definition{
+				Type: jsonschema.Object,
+				Properties: map[string]jsonschema.Definition{
+					"text": {
+						Type:        jsonschema.String,
+						Description: "The text printed on the page, a single paragraph",
+					},
+					"illustration": {
+						Type:        jsonschema.String,
+						Description: "A brief idea for the illustration on the page",
+					},
+				},
+				Required: []string{"text", "illustration"},
+			},
+		},
+		"moral": {
+			Type:        jsonschema.String,
+			Description: "The lesson of the story in one sentence",
+		},
+	},
+	Required: []string{"title", "pages", "moral"},
+}
+
+// Pages that are only there to say the story is over.
+var endPagePattern = regexp.MustCompile(`^(the end|fin|end)$`)
+
+// Asks for the story as a StoryDraft. ErrStructuredUnsupported means the
+// provider can't do it and the story should be asked for the plain way.
+func getStoryDraft(ctx context.Context, synopsis StorySynopsis) (StoryDraft, string, error) {
+	draft := StoryDraft{}
+	structured, ok := textGenerator.(StructuredTextGenerator)
+	if !ok {
+		return draft, "", ErrStructuredUnsupported
+	}
+	prompt, err := renderPrompt("story_structured", getPromptData(synopsis))
+	if err != nil {
+		return draft, "", err
+	}
+	var resp string
+	err = apiRetryPolicy.Do(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = structured.GenerateStructured(ctx, prompt, "write_story", storyDraftSchema)
+		return err
+	})
+	if err != nil {
+		return draft, "", err
+	}
+	err = json.Unmarshal([]byte(resp), &draft)
+	if err != nil {
+		return draft, "", fmt.Errorf("%w: %s", ErrStoryFormat, err)
+	}
+	draft, err = cleanStoryDraft(draft)
+
+	return draft, resp, err
+}
+
+// Tidies up what came back and makes sure there's a story in there. Every
+// page has to be one paragraph since that's what ends up on the slide.
+func cleanStoryDraft(draft StoryDraft) (StoryDraft, error) {
+	draft.Title = strings.Trim(strings.TrimSpace(draft.Title), `"`)
+	draft.Moral = strings.TrimSpace(draft.Moral)
+	if draft.Title == "" {
+		return draft, fmt.Errorf("%w: there's no title", ErrStoryFormat)
+	}
+
+	pages := make([]StoryDraftPage, 0, len(draft.Pages))
+	for _, page := range draft.Pages {
+		page.Text = strings.Join(strings.Fields(page.Text), " ")
+		page.Illustration = strings.Join(strings.Fields(page.Illustration), " ")
+		ending := strings.ToLower(strings.Trim(page.Text, ".!* "))
+		if page.Text == "" || endPagePattern.MatchString(ending) {
+			continue
+		}
+		pages = append(pages, page)
+	}
+	draft.Pages = pages
+	if len(draft.Pages) == 0 {
+		return draft, fmt.Errorf("%w: there are no pages", ErrStoryFormat)
+	}
+
+	return draft, nil
+}
+
+func applyStoryDraft(story *Story, draft StoryDraft) {
+	story.Title = draft.Title
+	story.Moral = draft.Moral
+	story.Paragraphs = make([]string, 0, len(draft.Pages))
+	story.IllustrationHints = make([]string, 0, len(draft.Pages))
+	for _, page := range draft.Pages {
+		story.Paragraphs = append(story.Paragraphs, page.Text)
+		story.IllustrationHints = append(story.IllustrationHints, page.Illustration)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+	"hash/fnv"
+	"net/http"
+	"strings"
+)
+
+type TextGenerator interface {
+	Generate(ctx context.Context, prompt string) (string, error)
+}
+
+// StructuredTextGenerator is a TextGenerator that can also be made to answer
+// with JSON matching a schema, by way of a function call. Anything that
+// can't hands back ErrStructuredUnsupported and gets asked the plain way.
+type StructuredTextGenerator interface {
+	GenerateStructured(ctx context.Context, prompt string, name string, schema jsonschema.Definition) (string, error)
+}
+
+// OpenAITextGenerator talks to anything that speaks the OpenAI chat
+// completions API. That's OpenAI itself, but also local servers like
+// llama.cpp or Ollama when given a different base URL.
+type OpenAITextGenerator struct {
+	Client *openai.Client
+	Model  string
+}
+
+func (generator *OpenAITextGenerator) Generate(ctx context.Context, prompt string) (string, error) {
+	resp, err := generator.Client.CreateChatCompletion(
+		ctx,
+		openai.ChatCompletionRequest{
+			Model: generator.Model,
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role:    openai.ChatMessageRoleUser,
+					Content: prompt,
+				},
+			},
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	recordUsage(ctx, resp.Usage.TotalTokens, 0)
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no choices returned from %s", generator.Model)
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+func (generator *OpenAITextGenerator) GenerateStructured(ctx context.Context, prompt string, name string, schema jsonschema.Definition) (string, error) {
+	resp, err := generator.Client.CreateChatCompletion(
+		ctx,
+		openai.ChatCompletionRequest{
+			Model: generator.Model,
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role:    openai.ChatMessageRoleUser,
+					Content: prompt,
+				},
+			},
+			Functions:    []openai.FunctionDefinition{{Name: name, Parameters: schema}},
+			FunctionCall: openai.FunctionCall{Name: name},
+		},
+	)
+	if err != nil {
+		// Local servers and older models turn the whole request down
+		var apiErr *openai.APIError
+		if errors.As(err, &apiErr) && !isRetryableStatus(apiErr.HTTPStatusCode) && apiErr.HTTPStatusCode != http.StatusUnauthorized {
+			return "", fmt.Errorf("%w: %s", ErrStructuredUnsupported, err)
+		}
+		return "", err
+	}
+	recordUsage(ctx, resp.Usage.TotalTokens, 0)
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no choices returned from %s", generator.Model)
+	}
+	// Some of them take the request and ignore the function entirely
+	call := resp.Choices[0].Message.FunctionCall
+	if call == nil || call.Name != name {
+		return "", fmt.Errorf("%w: %s answered without calling %s", ErrStructuredUnsupported, generator.Model, name)
+	}
+
+	return call.Arguments, nil
+}
+
+// FakeTextGenerator never leaves the machine. It gives the same answer for
+// the same prompt every time so runs are repeatable in CI.
+type FakeTextGenerator struct{}
+
+var fakeStoryParagraphs = []string{
+	"Once upon a time there was a little animal with a very big dream.",
+	"Every morning it practiced, and every morning it fell down, but it always got back up again.",
+	"One day a wise old owl told it that dreams take patience and a little help from friends.",
+	"So it asked its friends for help, and together they tried one more time.",
+	"In the end it learned that the journey was just as wonderful as the dream itself.",
+}
+
+var fakeDescriptions = []string{
+	"A small animal standing on a grassy hill at sunrise, looking up at the sky.",
+	"A group of friendly animals gathered under a large oak tree.",
+	"A winding river through a forest with soft morning light.",
+	"A cozy den filled with blankets and warm lantern light.",
+	"A meadow full of wildflowers with butterflies overhead.",
+}
+
+var fakeCharacter = CharacterSheet{
+	Species:     "plains zebra",
+	Colors:      "black and white stripes with a grey muzzle",
+	Clothing:    "a red knitted scarf",
+	Markings:    "one stripe on the left ear that zigzags",
+	Description: "a small plains zebra with black and white stripes, a grey muzzle, a zigzag stripe on the left ear and a red knitted scarf",
+}
+
+func (generator *FakeTextGenerator) Generate(ctx context.Context, prompt string) (string, error) {
+	lower := strings.ToLower(prompt)
+	switch {
+	case strings.Contains(lower, "title:"):
+		return `TITLE: "The Very Big Dream"`, nil
+	case strings.Contains(lower, "write me a short story"):
+		return strings.Join(fakeStoryParagraphs, "\n\n"), nil
+	case strings.Contains(lower, "distinguishing marks"):
+		return fakeCharacter.Description, nil
+	case strings.Contains(lower, "rewrite the following paragraph"):
+		return "It did not give up. It tried and tried again.", nil
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(prompt))
+	index := int(hash.Sum32() % uint32(len(fakeDescriptions)))
+	return fakeDescriptions[index], nil
+}
+
+func (generator *FakeTextGenerator) GenerateStructured(ctx context.Context, prompt string, name string, schema jsonschema.Definition) (string, error) {
+	if name == "describe_character" {
+		sheetBytes, err := json.Marshal(fakeCharacter)
+		return string(sheetBytes), err
+	}
+	pages := make([]StoryDraftPage, 0, len(fakeStoryParagraphs))
+	for index, paragraph := range fakeStoryParagraphs {
+		pages = append(pages, StoryDraftPage{Text: paragraph, Illustration: fakeDescriptions[index%len(fakeDescriptions)]})
+	}
+	draftBytes, err := json.Marshal(StoryDraft{
+		Title: "The Very Big Dream",
+		Pages: append(pages, StoryDraftPage{Text: "THE END"}),
+		Moral: "Big dreams take patience and a little help from friends.",
+	})
+
+	return string(draftBytes), err
+}
+
+func getTextGenerator() TextGenerator {
+	switch TEXT_PROVIDER {
+	case "openai":
+		model := TEXT_MODEL
+		if model == "" {
+			model = openai.GPT3Dot5Turbo
+		}
+		config := openai.DefaultConfig(OPEN_AI_KEY)
+		config.HTTPClient = httpClient
+		return &OpenAITextGenerator{
+			Client: openai.NewClientWithConfig(config),
+			Model:  model,
+		}
+	case "local":
+		config := openai.DefaultConfig(OPEN_AI_KEY)
+		config.BaseURL = LOCAL_TEXT_URL
+		config.HTTPClient = httpClient
+		model := TEXT_MODEL
+		if model == "" {
+			model = "llama2"
+		}
+		return &OpenAITextGenerator{
+			Client: openai.NewClientWithConfig(config),
+			Model:  model,
+		}
+	case "fake":
+		return &FakeTextGenerator{}
+	}
+	panic(fmt.Sprintf("unknown TEXT_PROVIDER %q", TEXT_PROVIDER))
+}